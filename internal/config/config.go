@@ -1,21 +1,98 @@
 package config
 
 import (
+	"encoding/json"
 	"log" // For warnings (or use your logger)
 	"os"
 	"strconv"
 	"strings"
 )
 
+// OIDCProvider is an external OpenID Connect identity provider users can sign in with
+type OIDCProvider struct {
+	Name         string            `json:"name"` // URL segment: /login/oidc/<name>
+	DisplayName  string            `json:"display_name"`
+	Issuer       string            `json:"issuer"`
+	ClientID     string            `json:"client_id"`
+	ClientSecret string            `json:"client_secret"`
+	Scopes       []string          `json:"scopes"` // Defaults to openid, email and profile
+	Claims       map[string]string `json:"claims"` // Provider claim for email, email_verified and username
+}
+
+// SAMLProvider is an external SAML 2.0 identity provider users can sign in with
+type SAMLProvider struct {
+	Name         string            `json:"name"` // URL segment: /login/saml/<name>
+	DisplayName  string            `json:"display_name"`
+	MetadataURL  string            `json:"metadata_url"`  // IdP metadata, fetched on first use
+	MetadataFile string            `json:"metadata_file"` // Alternative to metadata_url
+	Attributes   map[string]string `json:"attributes"`    // Attribute for subject, email and username
+	TrustEmail   bool              `json:"trust_email"`   // The IdP only asserts verified emails
+	DefaultRole  string            `json:"default_role"`  // Role of provisioned users, defaults to user
+}
+
+// LDAPConfig is the directory users can sign in against with their directory password
+type LDAPConfig struct {
+	URLs              []string // ldap:// or ldaps://, tried in order until one is reachable
+	StartTLS          bool     // Upgrade ldap:// connections before binding
+	CAFile            string   // PEM bundle to verify the directory's certificate, defaults to system roots
+	BindDN            string   // Service account that searches users, anonymous if empty
+	BindPassword      string
+	BaseDN            string
+	UserFilter        string // {login} is replaced with the escaped login name
+	IDAttribute       string // Stable entry identifier, entryUUID or objectGUID
+	EmailAttribute    string
+	UsernameAttribute string
+	GroupAttribute    string
+	GroupRoles        []LDAPGroupRole // First group the user is a member of wins
+	DefaultRole       string
+	LinkExisting      bool // Link entries to existing local accounts with the same verified email
+}
+
+// LDAPGroupRole maps members of a directory group to a role
+type LDAPGroupRole struct {
+	Group string `json:"group"` // Group DN
+	Role  string `json:"role"`
+}
+
+// Enabled reports whether a directory is configured.
+func (c LDAPConfig) Enabled() bool {
+	return len(c.URLs) > 0
+}
+
 type Config struct {
 	AppVersion      string
 	GinMode         string
 	Port            string
-	JWT_SECRET      []byte
+	JWT_SECRET      []byte // Signs internal tokens (refresh, MFA challenge, email links)
+	JWTKeysDir      string // PEM private keys for access tokens, named <kid>.pem
+	JWTActiveKeyID  string
+	IssuerURL       string // OpenID Connect issuer, the public base URL of this service
+	OIDCClientID    string
 	AllowOrigins    []string
 	RateLimitPerSec int
 	DB_DSN          string
 	RedisURL        string
+	MFAIssuer       string
+	WebAuthnRPID    string
+	WebAuthnRPName  string
+	WebAuthnOrigins []string
+
+	FrontendURL              string // Base URL used in links sent by email
+	RequireEmailVerification bool
+	MailDriver               string // log, file or smtp
+	MailFrom                 string
+	MailDir                  string
+	SMTPAddr                 string
+	SMTPUsername             string
+	SMTPPassword             string
+
+	InitialAccessToken string // Bearer token for dynamic client registration, empty disables it
+	OIDCProviders      []OIDCProvider
+	SAMLProviders      []SAMLProvider
+	SAMLCertFile       string // SP certificate and key for signed AuthnRequests and encrypted assertions
+	SAMLKeyFile        string
+	LDAP               LDAPConfig
+	Authenticators     []string // Order in which POST /login tries password authenticators
 }
 
 func LoadConfig(env string) *Config { // Changed to return pointer for consistency
@@ -24,10 +101,44 @@ func LoadConfig(env string) *Config { // Changed to return pointer for consisten
 		GinMode:         strings.TrimSpace(os.Getenv("GIN_MODE")), // Read from env
 		Port:            strings.TrimSpace(os.Getenv("PORT")), // Trim whitespace
 		JWT_SECRET:      []byte(os.Getenv("JWT_SECRET")),
+		JWTKeysDir:      strings.TrimSpace(os.Getenv("JWT_KEYS_DIR")),
+		JWTActiveKeyID:  strings.TrimSpace(os.Getenv("JWT_ACTIVE_KID")),
+		IssuerURL:       strings.TrimSuffix(strings.TrimSpace(os.Getenv("ISSUER_URL")), "/"),
+		OIDCClientID:    strings.TrimSpace(os.Getenv("FRONTEND_CLIENT_ID")),
 		AllowOrigins:    []string{"http://localhost:3000"},
 		RateLimitPerSec: 10,
 		DB_DSN:          strings.TrimSpace(os.Getenv("DB_DSN")),    // Trim
 		RedisURL:        strings.TrimSpace(os.Getenv("REDIS_URL")), // Trim
+		MFAIssuer:       strings.TrimSpace(os.Getenv("MFA_ISSUER")),
+		WebAuthnRPID:    strings.TrimSpace(os.Getenv("WEBAUTHN_RP_ID")),
+		WebAuthnRPName:  strings.TrimSpace(os.Getenv("WEBAUTHN_RP_NAME")),
+
+		FrontendURL:              strings.TrimRight(strings.TrimSpace(os.Getenv("FRONTEND_URL")), "/"),
+		RequireEmailVerification: strings.TrimSpace(os.Getenv("REQUIRE_EMAIL_VERIFICATION")) == "true",
+		MailDriver:               strings.TrimSpace(os.Getenv("MAIL_DRIVER")),
+		MailFrom:                 strings.TrimSpace(os.Getenv("MAIL_FROM")),
+		MailDir:                  strings.TrimSpace(os.Getenv("MAIL_DIR")),
+		SMTPAddr:                 strings.TrimSpace(os.Getenv("SMTP_ADDR")),
+		SMTPUsername:             strings.TrimSpace(os.Getenv("SMTP_USERNAME")),
+		SMTPPassword:             os.Getenv("SMTP_PASSWORD"),
+
+		InitialAccessToken: strings.TrimSpace(os.Getenv("OAUTH_INITIAL_ACCESS_TOKEN")),
+		SAMLCertFile:       strings.TrimSpace(os.Getenv("SAML_SP_CERT_FILE")),
+		SAMLKeyFile:        strings.TrimSpace(os.Getenv("SAML_SP_KEY_FILE")),
+		LDAP: LDAPConfig{
+			StartTLS:          strings.TrimSpace(os.Getenv("LDAP_START_TLS")) == "true",
+			CAFile:            strings.TrimSpace(os.Getenv("LDAP_CA_FILE")),
+			BindDN:            strings.TrimSpace(os.Getenv("LDAP_BIND_DN")),
+			BindPassword:      os.Getenv("LDAP_BIND_PASSWORD"),
+			BaseDN:            strings.TrimSpace(os.Getenv("LDAP_BASE_DN")),
+			UserFilter:        strings.TrimSpace(os.Getenv("LDAP_USER_FILTER")),
+			IDAttribute:       strings.TrimSpace(os.Getenv("LDAP_ID_ATTRIBUTE")),
+			EmailAttribute:    strings.TrimSpace(os.Getenv("LDAP_EMAIL_ATTRIBUTE")),
+			UsernameAttribute: strings.TrimSpace(os.Getenv("LDAP_USERNAME_ATTRIBUTE")),
+			GroupAttribute:    strings.TrimSpace(os.Getenv("LDAP_GROUP_ATTRIBUTE")),
+			DefaultRole:       strings.TrimSpace(os.Getenv("LDAP_DEFAULT_ROLE")),
+			LinkExisting:      strings.TrimSpace(os.Getenv("LDAP_LINK_EXISTING_ACCOUNTS")) == "true",
+		},
 	}
 
 	// Set default GIN_MODE if not provided
@@ -43,6 +154,123 @@ func LoadConfig(env string) *Config { // Changed to return pointer for consisten
 		cfg.Port = "8080"
 	}
 
+	if cfg.OIDCClientID == "" {
+		cfg.OIDCClientID = "frontend" // Audience of ID tokens issued by direct logins
+	}
+
+	if providers := strings.TrimSpace(os.Getenv("OIDC_PROVIDERS")); providers != "" {
+		if err := json.Unmarshal([]byte(providers), &cfg.OIDCProviders); err != nil {
+			panic("OIDC_PROVIDERS is not a valid JSON list of providers: " + err.Error())
+		}
+		for _, provider := range cfg.OIDCProviders {
+			if provider.Name == "" || provider.Issuer == "" || provider.ClientID == "" {
+				panic("OIDC_PROVIDERS entries require name, issuer and client_id")
+			}
+		}
+	}
+
+	if providers := strings.TrimSpace(os.Getenv("SAML_PROVIDERS")); providers != "" {
+		if err := json.Unmarshal([]byte(providers), &cfg.SAMLProviders); err != nil {
+			panic("SAML_PROVIDERS is not a valid JSON list of providers: " + err.Error())
+		}
+		for _, provider := range cfg.SAMLProviders {
+			if provider.Name == "" || (provider.MetadataURL == "" && provider.MetadataFile == "") {
+				panic("SAML_PROVIDERS entries require name and metadata_url or metadata_file")
+			}
+		}
+	}
+	// Linked identities are stored by provider name, whatever the protocol
+	names := map[string]bool{"ldap": true}
+	claim := func(name string) {
+		if names[name] {
+			panic("identity provider name " + name + " is reserved or used more than once")
+		}
+		names[name] = true
+	}
+	for _, provider := range cfg.OIDCProviders {
+		claim(provider.Name)
+	}
+	for _, provider := range cfg.SAMLProviders {
+		claim(provider.Name)
+	}
+	if (cfg.SAMLCertFile == "") != (cfg.SAMLKeyFile == "") {
+		panic("SAML_SP_CERT_FILE and SAML_SP_KEY_FILE must be set together")
+	}
+
+	if urls := strings.TrimSpace(os.Getenv("LDAP_URLS")); urls != "" {
+		for _, url := range strings.Split(urls, ",") {
+			url = strings.TrimSpace(url)
+			if cfg.LDAP.StartTLS && strings.HasPrefix(url, "ldaps://") {
+				panic("LDAP_START_TLS cannot be used with ldaps:// URLs")
+			}
+			cfg.LDAP.URLs = append(cfg.LDAP.URLs, url)
+		}
+		if cfg.LDAP.BaseDN == "" {
+			panic("LDAP_BASE_DN not set - required to search directory users")
+		}
+	}
+	if roles := strings.TrimSpace(os.Getenv("LDAP_GROUP_ROLES")); roles != "" {
+		if err := json.Unmarshal([]byte(roles), &cfg.LDAP.GroupRoles); err != nil {
+			panic("LDAP_GROUP_ROLES is not a valid JSON list of group roles: " + err.Error())
+		}
+	}
+	if cfg.LDAP.UserFilter == "" {
+		cfg.LDAP.UserFilter = "(|(mail={login})(uid={login}))"
+	}
+	if cfg.LDAP.IDAttribute == "" {
+		cfg.LDAP.IDAttribute = "entryUUID"
+	}
+	if cfg.LDAP.EmailAttribute == "" {
+		cfg.LDAP.EmailAttribute = "mail"
+	}
+	if cfg.LDAP.UsernameAttribute == "" {
+		cfg.LDAP.UsernameAttribute = "uid"
+	}
+	if cfg.LDAP.GroupAttribute == "" {
+		cfg.LDAP.GroupAttribute = "memberOf"
+	}
+	if cfg.LDAP.DefaultRole == "" {
+		cfg.LDAP.DefaultRole = "user"
+	}
+
+	if authenticators := strings.TrimSpace(os.Getenv("LOGIN_AUTHENTICATORS")); authenticators != "" {
+		for _, name := range strings.Split(authenticators, ",") {
+			name = strings.TrimSpace(name)
+			switch {
+			case name == "ldap" && !cfg.LDAP.Enabled():
+				panic("LOGIN_AUTHENTICATORS includes ldap but LDAP_URLS is not set")
+			case name != "password" && name != "ldap":
+				panic("unknown authenticator " + name + " in LOGIN_AUTHENTICATORS")
+			}
+			cfg.Authenticators = append(cfg.Authenticators, name)
+		}
+	} else if cfg.LDAP.Enabled() {
+		cfg.Authenticators = []string{"ldap", "password"}
+	} else {
+		cfg.Authenticators = []string{"password"}
+	}
+
+	if cfg.MFAIssuer == "" {
+		cfg.MFAIssuer = "Gin Auth Service" // Shown as the account label in authenticator apps
+	}
+
+	if cfg.WebAuthnRPID == "" {
+		cfg.WebAuthnRPID = "localhost"
+	}
+	if cfg.WebAuthnRPName == "" {
+		cfg.WebAuthnRPName = cfg.MFAIssuer
+	}
+
+	if cfg.FrontendURL == "" {
+		cfg.FrontendURL = "http://localhost:3000"
+	}
+	if cfg.MailFrom == "" {
+		cfg.MailFrom = "no-reply@localhost"
+	}
+	if cfg.MailDir == "" {
+		cfg.MailDir = "./tmp/mail"
+	}
+
 	if env == "production" {
 		cfg.GinMode = "release"
 		if cfg.Port == "8080" { // Default if unset
@@ -69,18 +297,43 @@ func LoadConfig(env string) *Config { // Changed to return pointer for consisten
 		if cfg.RedisURL == "" {
 			log.Println("Warning: REDIS_URL not set in production. Token blacklisting disabled.")
 		}
+		if cfg.JWTKeysDir == "" {
+			panic("JWT_KEYS_DIR not set - required for access token signing in production")
+		}
+		if cfg.IssuerURL == "" {
+			panic("ISSUER_URL not set - required for OpenID Connect discovery in production")
+		}
+	}
+
+	if cfg.IssuerURL == "" {
+		cfg.IssuerURL = "http://localhost:" + cfg.Port
+	}
+
+	// Passkeys are only accepted from these origins; default to the CORS origins
+	cfg.WebAuthnOrigins = cfg.AllowOrigins
+	if origins := os.Getenv("WEBAUTHN_RP_ORIGINS"); origins != "" {
+		cfg.WebAuthnOrigins = strings.Split(strings.TrimSpace(origins), ",")
+		for i := range cfg.WebAuthnOrigins {
+			cfg.WebAuthnOrigins[i] = strings.TrimSpace(cfg.WebAuthnOrigins[i])
+		}
 	}
 
 	// Validate required fields
 	if string(cfg.JWT_SECRET) == "" {
 		panic("JWT_SECRET not set - required for JWT signing")
 	}
+	if cfg.JWTKeysDir != "" && cfg.JWTActiveKeyID == "" {
+		panic("JWT_ACTIVE_KID not set - required to pick the signing key from JWT_KEYS_DIR")
+	}
 	if cfg.DB_DSN == "" {
 		panic("DB_DSN not set - required for database connection")
 	}
 	if cfg.Port == "" {
 		panic("PORT not set - required for server binding")
 	}
+	if cfg.GinMode == "release" && (cfg.MailDriver == "" || cfg.MailDriver == "log") {
+		panic("MAIL_DRIVER not set - the log driver writes sign-in and reset links to the log, use smtp or file in release mode")
+	}
 
 	return cfg
 }
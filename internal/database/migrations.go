@@ -9,7 +9,7 @@ func RunMigrations(db *Database, log *logrus.Logger) error {
 	log.Info("Running database migrations...")
 	
 	// Run auto migrations
-	if err := db.AutoMigrate(&model.Role{}, &model.User{}); err != nil {
+	if err := db.AutoMigrate(&model.Role{}, &model.User{}, &model.RefreshToken{}, &model.Session{}, &model.TOTPFactor{}, &model.PasskeyCredential{}, &model.PasswordResetToken{}, &model.OAuthClient{}, &model.OAuthGrant{}, &model.LogoutDelivery{}, &model.Identity{}, &model.PersonalAccessToken{}); err != nil {
 		log.WithError(err).Error("Failed to run auto migrations")
 		return err
 	}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -21,7 +22,7 @@ func NewAuthHandler(svc *service.AuthService, log *logrus.Logger) *AuthHandler {
 
 // Register godoc
 // @Summary Register a new user
-// @Description Register a new user account with username, email and password
+// @Description Register a new user account with username, email and password. A verification link is emailed to the new address
 // @Tags Authentication
 // @Accept json
 // @Produce json
@@ -51,52 +52,94 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	h.log.WithField("username", user.Username).Info("User registered")
-	c.JSON(http.StatusCreated, gin.H{"message": "User registered"})
+	c.JSON(http.StatusCreated, gin.H{"message": "User registered, check your email to verify your address"})
 }
 
 // Login godoc
 // @Summary User login
-// @Description Authenticate user with email and password, returns access and refresh tokens
+// @Description Authenticate user with email and password, returns access and refresh tokens. The credentials go through the authenticators in LOGIN_AUTHENTICATORS (local password, LDAP) in order; with LDAP the login may also be a directory username. Users enrolled in MFA instead receive an mfa_token to complete at /login/mfa
 // @Tags Authentication
 // @Accept json
 // @Produce json
 // @Param request body model.LoginRequest true "Login request"
-// @Success 200 {object} map[string]interface{} "Login successful with tokens and user info"
+// @Success 200 {object} map[string]interface{} "Login successful with tokens and user info, or MFA challenge"
 // @Failure 400 {object} map[string]string "Bad request - validation error"
 // @Failure 401 {object} map[string]string "Unauthorized - invalid credentials"
+// @Failure 403 {object} map[string]string "Forbidden - email address not verified"
+// @Failure 409 {object} map[string]string "Conflict - directory login matches an existing account that is not linked to the directory"
 // @Router /login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
 	var input struct {
-		Email    string `json:"email" binding:"required,email"`
-		Password string `json:"password" binding:"required"`
+		Email      string `json:"email" binding:"required,max=255"`
+		Password   string `json:"password" binding:"required"`
+		DeviceName string `json:"device_name" binding:"max=255"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		errs.HandleValidationError(c, err, h.log)
 		return
 	}
 
-	user, accessToken, refreshToken, err := h.service.Login(input.Email, input.Password)
+	result, err := h.service.Login(input.Email, input.Password, sessionInfo(c, input.DeviceName))
+	if errors.Is(err, service.ErrEmailNotVerified) {
+		errs.HandleError(c, errs.NewAPIError(http.StatusForbidden, "Email address not verified", err), h.log)
+		return
+	}
+	if errors.Is(err, service.ErrIdentityConflict) {
+		errs.HandleError(c, errs.NewAPIError(http.StatusConflict, "An account with this email already exists and is not linked to the directory", err), h.log)
+		return
+	}
 	if err != nil {
 		errs.HandleError(c, errs.NewAPIError(http.StatusUnauthorized, "Invalid credentials", err), h.log)
 		return
 	}
 
-	h.log.WithField("username", user.Username).Info("User logged in")
+	respondLogin(c, result, h.log)
+}
+
+// LoginMFA godoc
+// @Summary Complete MFA login
+// @Description Exchange the mfa_token returned by /login and a TOTP code for access and refresh tokens. The mfa_token is single-use
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body model.MFALoginRequest true "MFA login request"
+// @Success 200 {object} map[string]interface{} "Login successful with tokens and user info"
+// @Failure 400 {object} map[string]string "Bad request - validation error"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid challenge or code"
+// @Router /login/mfa [post]
+func (h *AuthHandler) LoginMFA(c *gin.Context) {
+	var input struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		Code     string `json:"code" binding:"required,len=6,numeric"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	user, tokens, err := h.service.CompleteMFALogin(input.MFAToken, input.Code, sessionInfo(c, ""))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusUnauthorized, "Invalid MFA challenge or code", err), h.log)
+		return
+	}
+
+	h.log.WithField("username", user.Username).Info("User logged in with MFA")
 	c.JSON(http.StatusOK, gin.H{
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"id_token":      tokens.IDToken,
 		"user":          user,
 	})
 }
 
 // RefreshToken godoc
 // @Summary Refresh access token
-// @Description Generate a new access token using a valid refresh token
+// @Description Exchange a valid refresh token for a new access token and a rotated refresh token. Reusing a rotated refresh token revokes its whole token family
 // @Tags Authentication
 // @Accept json
 // @Produce json
 // @Param request body model.RefreshTokenRequest true "Refresh token request"
-// @Success 200 {object} map[string]string "New access token generated"
+// @Success 200 {object} map[string]string "New access and refresh tokens generated"
 // @Failure 400 {object} map[string]string "Bad request - validation error"
 // @Failure 401 {object} map[string]string "Unauthorized - invalid refresh token"
 // @Router /refresh [post]
@@ -109,19 +152,23 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	accessToken, err := h.service.RefreshToken(input.RefreshToken)
+	tokens, err := h.service.RefreshToken(input.RefreshToken, "", sessionInfo(c, ""))
 	if err != nil {
 		errs.HandleError(c, errs.NewAPIError(http.StatusUnauthorized, "Invalid refresh token", err), h.log)
 		return
 	}
 
 	h.log.Info("Token refreshed")
-	c.JSON(http.StatusOK, gin.H{"access_token": accessToken})
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"id_token":      tokens.IDToken,
+	})
 }
 
 // Logout godoc
 // @Summary User logout
-// @Description Logout user by blacklisting the refresh token
+// @Description Logout user by revoking the refresh token's family and blacklisting the refresh token
 // @Tags Authentication
 // @Accept json
 // @Produce json
@@ -146,3 +193,31 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 	h.log.Info("User logged out")
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
 }
+
+func sessionInfo(c *gin.Context, deviceName string) service.SessionInfo {
+	return service.SessionInfo{
+		DeviceName: deviceName,
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+}
+
+// respondLogin writes either the MFA challenge or the token pair of a login result.
+func respondLogin(c *gin.Context, result *service.LoginResult, log *logrus.Logger) {
+	if result.MFAToken != "" {
+		log.WithField("username", result.User.Username).Info("MFA challenge issued")
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    result.MFAToken,
+		})
+		return
+	}
+
+	log.WithFields(logrus.Fields{"username": result.User.Username, "method": result.Method}).Info("User logged in")
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  result.Tokens.AccessToken,
+		"refresh_token": result.Tokens.RefreshToken,
+		"id_token":      result.Tokens.IDToken,
+		"user":          result.User,
+	})
+}
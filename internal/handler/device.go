@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shahariaz/gin-auth-service/internal/errs"
+	"github.com/shahariaz/gin-auth-service/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+type DeviceHandler struct {
+	service *service.DeviceService
+	log     *logrus.Logger
+}
+
+func NewDeviceHandler(svc *service.DeviceService, log *logrus.Logger) *DeviceHandler {
+	return &DeviceHandler{service: svc, log: log}
+}
+
+// DeviceAuthorization godoc
+// @Summary OAuth 2.0 device authorization endpoint
+// @Description Start the device flow (RFC 8628) for input-constrained devices such as CLIs and TVs. Show the user_code and verification_uri to the user, then poll /oauth/token with the device_code no faster than interval seconds
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param client_id formData string false "Client ID, unless sent with HTTP Basic"
+// @Param client_secret formData string false "Client secret of confidential clients"
+// @Param scope formData string false "Space separated scopes, defaults to all scopes allowed for the client"
+// @Success 200 {object} service.DeviceAuthorizationResponse "Device and user codes"
+// @Failure 400 {object} map[string]string "OAuth error"
+// @Failure 401 {object} map[string]string "Client authentication failed"
+// @Router /oauth/device_authorization [post]
+func (h *DeviceHandler) DeviceAuthorization(c *gin.Context) {
+	var input struct {
+		ClientID     string `form:"client_id"`
+		ClientSecret string `form:"client_secret"`
+		Scope        string `form:"scope"`
+	}
+	c.Header("Cache-Control", "no-store")
+	if err := c.ShouldBind(&input); err != nil {
+		respondOAuthError(c, &service.OAuthError{Code: "invalid_request", Description: "Malformed request"}, h.log)
+		return
+	}
+
+	clientID, clientSecret := clientCredentials(c, input.ClientID, input.ClientSecret)
+
+	response, err := h.service.Authorize(clientID, clientSecret, input.Scope)
+	if err != nil {
+		respondOAuthError(c, err, h.log)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetDeviceRequest godoc
+// @Summary Look up a device authorization
+// @Description Show which client and scopes a user code belongs to, so that the user can confirm before approving
+// @Tags OAuth
+// @Produce json
+// @Security BearerAuth
+// @Param user_code query string true "User code shown on the device"
+// @Success 200 {object} service.DeviceRequest "Pending device authorization"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 404 {object} map[string]string "Unknown or expired user code"
+// @Router /api/oauth/device [get]
+func (h *DeviceHandler) GetDeviceRequest(c *gin.Context) {
+	request, err := h.service.Lookup(c.Query("user_code"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusNotFound, "Unknown or expired user code", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, request)
+}
+
+// DecideDeviceRequest godoc
+// @Summary Approve or deny a device authorization
+// @Description Approve (or deny) the device showing the user code for the logged-in user. The device receives its tokens on its next poll
+// @Tags OAuth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.DeviceDecisionRequest true "User code and decision"
+// @Success 200 {object} map[string]string "Decision recorded"
+// @Failure 400 {object} map[string]string "Bad request - validation error"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 404 {object} map[string]string "Unknown or expired user code"
+// @Router /api/oauth/device [post]
+func (h *DeviceHandler) DecideDeviceRequest(c *gin.Context) {
+	var input struct {
+		UserCode string `json:"user_code" binding:"required"`
+		Approve  bool   `json:"approve"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	if err := h.service.Decide(c.GetUint("user_id"), input.UserCode, input.Approve); err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusNotFound, "Unknown or expired user code", err), h.log)
+		return
+	}
+	message := "Device denied"
+	if input.Approve {
+		message = "Device approved"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shahariaz/gin-auth-service/internal/errs"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+const federatedLoginCookie = "oidc_login"
+
+type FederationHandler struct {
+	service       *service.FederationService
+	auth          *service.AuthService
+	secureCookies bool
+	log           *logrus.Logger
+}
+
+func NewFederationHandler(svc *service.FederationService, auth *service.AuthService, secureCookies bool, log *logrus.Logger) *FederationHandler {
+	return &FederationHandler{service: svc, auth: auth, secureCookies: secureCookies, log: log}
+}
+
+// ListProviders godoc
+// @Summary List external identity providers
+// @Description List the OpenID Connect providers users can sign in with
+// @Tags Authentication
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Configured providers"
+// @Router /login/oidc [get]
+func (h *FederationHandler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.service.Providers()})
+}
+
+// BeginLogin godoc
+// @Summary Sign in with an external identity provider
+// @Description Redirect the browser to the provider's login page. The callback only works in the same browser, which receives a binding cookie
+// @Tags Authentication
+// @Param provider path string true "Provider name"
+// @Param device_name query string false "Name of the device, shown in the session list"
+// @Success 302 "Redirect to the provider"
+// @Failure 404 {object} map[string]string "Unknown provider"
+// @Failure 502 {object} map[string]string "Provider unavailable"
+// @Router /login/oidc/{provider} [get]
+func (h *FederationHandler) BeginLogin(c *gin.Context) {
+	var input struct {
+		DeviceName string `form:"device_name" binding:"max=255"`
+	}
+	if err := c.ShouldBindQuery(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	binding, err := lib.NewOpaqueToken()
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Internal server error", err), h.log)
+		return
+	}
+	authURL, err := h.service.Begin(c.Param("provider"), binding, input.DeviceName)
+	if errors.Is(err, service.ErrUnknownProvider) {
+		errs.HandleError(c, errs.NewAPIError(http.StatusNotFound, "Unknown identity provider", err), h.log)
+		return
+	}
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadGateway, "Identity provider unavailable", err), h.log)
+		return
+	}
+
+	setFederatedLoginCookie(c, binding, h.secureCookies)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback godoc
+// @Summary External identity provider callback
+// @Description Redirect URI registered at the provider. Validates the ID token and returns access and refresh tokens (or an MFA challenge). First-time users get an account, or are linked to the account with the same email if both sides verified it. For a link started from the profile, returns the linked identity instead
+// @Tags Authentication
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param code query string false "Authorization code"
+// @Param state query string true "State from the authorization request"
+// @Param error query string false "Error returned by the provider"
+// @Success 200 {object} map[string]interface{} "Login successful with tokens and user info, MFA challenge, or linked identity"
+// @Failure 401 {object} map[string]string "Unauthorized - login failed or was cancelled"
+// @Failure 403 {object} map[string]string "Forbidden - email address not verified"
+// @Failure 409 {object} map[string]string "An account with this email already exists, or the identity is linked to another account"
+// @Router /login/oidc/{provider}/callback [get]
+func (h *FederationHandler) Callback(c *gin.Context) {
+	if providerError := c.Query("error"); providerError != "" {
+		errs.HandleError(c, errs.NewAPIError(http.StatusUnauthorized, "Login was cancelled at the identity provider", errors.New(providerError)), h.log)
+		return
+	}
+
+	binding, _ := c.Cookie(federatedLoginCookie)
+	federated, err := h.service.Complete(c.Param("provider"), c.Query("state"), c.Query("code"), binding)
+	if errors.Is(err, service.ErrIdentityConflict) || errors.Is(err, service.ErrIdentityLinked) {
+		errs.HandleError(c, errs.NewAPIError(http.StatusConflict, err.Error(), err), h.log)
+		return
+	}
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusUnauthorized, "Login with identity provider failed", err), h.log)
+		return
+	}
+	c.SetCookie(federatedLoginCookie, "", -1, "/login/oidc", "", h.secureCookies, true)
+
+	if federated.Linked != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Identity linked", "identity": federated.Linked})
+		return
+	}
+	result, err := h.auth.CompleteLogin(federated.Principal, sessionInfo(c, federated.DeviceName))
+	if errors.Is(err, service.ErrEmailNotVerified) {
+		errs.HandleError(c, errs.NewAPIError(http.StatusForbidden, "Email address not verified", err), h.log)
+		return
+	}
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to start session", err), h.log)
+		return
+	}
+	respondLogin(c, result, h.log)
+}
+
+// setFederatedLoginCookie gives the browser the binding secret checked on the callback.
+func setFederatedLoginCookie(c *gin.Context, binding string, secure bool) {
+	// Lax so that the cookie is sent on the provider's top-level redirect back to us
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(federatedLoginCookie, binding, int(service.FederatedLoginTTL.Seconds()), "/login/oidc", "", secure, true)
+}
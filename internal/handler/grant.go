@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shahariaz/gin-auth-service/internal/errs"
+	"github.com/shahariaz/gin-auth-service/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+type GrantHandler struct {
+	service *service.GrantService
+	log     *logrus.Logger
+}
+
+func NewGrantHandler(svc *service.GrantService, log *logrus.Logger) *GrantHandler {
+	return &GrantHandler{service: svc, log: log}
+}
+
+// ListGrants godoc
+// @Summary List application grants
+// @Description List the applications the authenticated user has granted access to, with the granted scopes
+// @Tags Grants
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Grants retrieved successfully"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/profile/grants [get]
+func (h *GrantHandler) ListGrants(c *gin.Context) {
+	grants, err := h.service.List(c.GetUint("user_id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to list grants", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"grants": grants})
+}
+
+// RevokeGrant godoc
+// @Summary Revoke an application grant
+// @Description Withdraw the authenticated user's consent for an application and log it out: its refresh tokens and sessions for the user are revoked
+// @Tags Grants
+// @Produce json
+// @Security BearerAuth
+// @Param client_id path string true "Client ID"
+// @Success 200 {object} map[string]interface{} "Grant revoked successfully"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 404 {object} map[string]string "Grant not found"
+// @Router /api/profile/grants/{client_id} [delete]
+func (h *GrantHandler) RevokeGrant(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	clientID := c.Param("client_id")
+	count, err := h.service.Revoke(userID, clientID)
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusNotFound, "Grant not found", err), h.log)
+		return
+	}
+	h.log.WithFields(logrus.Fields{"user_id": userID, "client_id": clientID, "revoked_sessions": count}).Info("Grant revoked")
+	c.JSON(http.StatusOK, gin.H{"message": "Grant revoked", "revoked_sessions": count})
+}
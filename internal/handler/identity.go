@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shahariaz/gin-auth-service/internal/errs"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+type IdentityHandler struct {
+	service       *service.IdentityService
+	federation    *service.FederationService
+	saml          *service.SAMLService
+	secureCookies bool
+	log           *logrus.Logger
+}
+
+func NewIdentityHandler(svc *service.IdentityService, federation *service.FederationService, saml *service.SAMLService, secureCookies bool, log *logrus.Logger) *IdentityHandler {
+	return &IdentityHandler{service: svc, federation: federation, saml: saml, secureCookies: secureCookies, log: log}
+}
+
+// ListIdentities godoc
+// @Summary List login methods
+// @Description List the ways the authenticated user can sign in: whether a password is set, linked external identities and passkeys
+// @Tags Identities
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} service.LoginMethods "Login methods retrieved successfully"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/profile/identities [get]
+func (h *IdentityHandler) ListIdentities(c *gin.Context) {
+	methods, err := h.service.List(c.GetUint("user_id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to list login methods", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, methods)
+}
+
+// LinkIdentity godoc
+// @Summary Link an external identity
+// @Description Start linking an account at an external OpenID Connect or SAML identity provider. Call it from the browser (with credentials, so that it stores the binding cookie) and navigate to the returned URL; the provider's callback links the identity
+// @Tags Identities
+// @Produce json
+// @Security BearerAuth
+// @Param provider path string true "Provider name"
+// @Success 200 {object} map[string]string "URL of the provider's login page"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 404 {object} map[string]string "Unknown provider"
+// @Failure 502 {object} map[string]string "Provider unavailable"
+// @Router /api/profile/identities/{provider}/link [post]
+func (h *IdentityHandler) LinkIdentity(c *gin.Context) {
+	binding, err := lib.NewOpaqueToken()
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Internal server error", err), h.log)
+		return
+	}
+	userID := c.GetUint("user_id")
+	authURL, err := h.federation.BeginLink(userID, c.Param("provider"), binding)
+	isSAML := errors.Is(err, service.ErrUnknownProvider)
+	if isSAML {
+		authURL, err = h.saml.BeginLink(userID, c.Param("provider"), binding)
+	}
+	if errors.Is(err, service.ErrUnknownProvider) {
+		errs.HandleError(c, errs.NewAPIError(http.StatusNotFound, "Unknown identity provider", err), h.log)
+		return
+	}
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadGateway, "Identity provider unavailable", err), h.log)
+		return
+	}
+
+	if isSAML {
+		setSAMLLoginCookie(c, binding)
+	} else {
+		setFederatedLoginCookie(c, binding, h.secureCookies)
+	}
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// UnlinkIdentity godoc
+// @Summary Unlink an external identity
+// @Description Remove a linked external identity from the authenticated user's account. The last remaining login method and the identity of a directory (LDAP) account cannot be removed
+// @Tags Identities
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Identity ID"
+// @Success 200 {object} map[string]string "Identity unlinked"
+// @Failure 400 {object} map[string]string "Bad request - invalid identity ID"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 404 {object} map[string]string "Identity not found"
+// @Failure 409 {object} map[string]string "Identity is the last login method, or the account's directory identity"
+// @Router /api/profile/identities/{id} [delete]
+func (h *IdentityHandler) UnlinkIdentity(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid identity ID", err), h.log)
+		return
+	}
+	err = h.service.Unlink(c.GetUint("user_id"), uint(id))
+	if errors.Is(err, service.ErrLastLoginMethod) || errors.Is(err, service.ErrIdentityManaged) {
+		errs.HandleError(c, errs.NewAPIError(http.StatusConflict, err.Error(), err), h.log)
+		return
+	}
+	if errors.Is(err, service.ErrIdentityNotFound) {
+		errs.HandleError(c, errs.NewAPIError(http.StatusNotFound, "Identity not found", err), h.log)
+		return
+	}
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to unlink identity", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Identity unlinked"})
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shahariaz/gin-auth-service/internal/errs"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+const magicLinkNonceCookie = "magic_link_nonce"
+
+type MagicLinkHandler struct {
+	service       *service.MagicLinkService
+	auth          *service.AuthService
+	secureCookies bool
+	log           *logrus.Logger
+}
+
+func NewMagicLinkHandler(svc *service.MagicLinkService, auth *service.AuthService, secureCookies bool, log *logrus.Logger) *MagicLinkHandler {
+	return &MagicLinkHandler{service: svc, auth: auth, secureCookies: secureCookies, log: log}
+}
+
+// RequestMagicLink godoc
+// @Summary Request a magic sign-in link
+// @Description Email a one-time sign-in link. The link only works in the browser that made this request, which receives a nonce cookie. The response is the same whether or not the account exists
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body model.MagicLinkRequest true "Email address"
+// @Success 200 {object} map[string]string "Request accepted"
+// @Failure 400 {object} map[string]string "Bad request - validation error"
+// @Router /login/magic-link [post]
+func (h *MagicLinkHandler) RequestMagicLink(c *gin.Context) {
+	var input struct {
+		Email      string `json:"email" binding:"required,email"`
+		DeviceName string `json:"device_name" binding:"max=255"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	nonce, err := lib.NewOpaqueToken()
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Internal server error", err), h.log)
+		return
+	}
+	if err := h.service.Request(input.Email, nonce, input.DeviceName); err != nil {
+		// Logged only: failing the request would reveal that the account exists
+		h.log.WithError(err).Error("Failed to create magic link")
+	}
+
+	// Set for every request so the response does not reveal whether the account exists
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(magicLinkNonceCookie, nonce, int(service.MagicLinkTTL.Seconds()), "/login/magic-link", "", h.secureCookies, true)
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists, a sign-in link has been sent"})
+}
+
+// ConsumeMagicLink godoc
+// @Summary Sign in with a magic link
+// @Description Exchange a magic link token for access and refresh tokens (or an MFA challenge). Must be called from the browser that requested the link. The token is accepted as a query parameter (GET) or JSON body (POST)
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param token query string false "Magic link token (GET)"
+// @Param request body model.MagicLinkConsumeRequest false "Magic link token (POST)"
+// @Success 200 {object} map[string]interface{} "Login successful with tokens and user info, or MFA challenge"
+// @Failure 400 {object} map[string]string "Bad request - missing token"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid, expired, used or foreign link"
+// @Router /login/magic-link/consume [get]
+// @Router /login/magic-link/consume [post]
+func (h *MagicLinkHandler) ConsumeMagicLink(c *gin.Context) {
+	token := c.Query("token")
+	if c.Request.Method == http.MethodPost {
+		var input struct {
+			Token string `json:"token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			errs.HandleValidationError(c, err, h.log)
+			return
+		}
+		token = input.Token
+	}
+	if token == "" {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Token is required", nil), h.log)
+		return
+	}
+
+	nonce, _ := c.Cookie(magicLinkNonceCookie)
+	user, deviceName, err := h.service.Consume(token, nonce)
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusUnauthorized, "Invalid or expired sign-in link", err), h.log)
+		return
+	}
+	c.SetCookie(magicLinkNonceCookie, "", -1, "/login/magic-link", "", h.secureCookies, true)
+
+	result, err := h.auth.CompleteLogin(&service.Principal{User: user, Method: service.MethodMagicLink}, sessionInfo(c, deviceName))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to start session", err), h.log)
+		return
+	}
+	respondLogin(c, result, h.log)
+}
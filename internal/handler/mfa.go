@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shahariaz/gin-auth-service/internal/errs"
+	"github.com/shahariaz/gin-auth-service/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+type MFAHandler struct {
+	service *service.MFAService
+	log     *logrus.Logger
+}
+
+func NewMFAHandler(svc *service.MFAService, log *logrus.Logger) *MFAHandler {
+	return &MFAHandler{service: svc, log: log}
+}
+
+// GetStatus godoc
+// @Summary Get MFA status
+// @Description Report whether the authenticated user has two-factor authentication enabled
+// @Tags MFA
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "MFA status"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/profile/mfa [get]
+func (h *MFAHandler) GetStatus(c *gin.Context) {
+	enabled, err := h.service.IsEnabled(c.GetUint("user_id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to load MFA status", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": enabled})
+}
+
+// EnrollTOTP godoc
+// @Summary Start TOTP enrollment
+// @Description Generate a new authenticator app secret, returned as raw secret, otpauth:// URI and QR code PNG. MFA is enabled only after confirmation
+// @Tags MFA
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} service.TOTPEnrollment "Enrollment started"
+// @Failure 400 {object} map[string]string "Bad request - MFA already enabled"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Router /api/profile/mfa/totp [post]
+func (h *MFAHandler) EnrollTOTP(c *gin.Context) {
+	enrollment, err := h.service.StartEnrollment(c.GetUint("user_id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Failed to start MFA enrollment", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTOTP godoc
+// @Summary Confirm TOTP enrollment
+// @Description Enable two-factor authentication by submitting a code from the newly enrolled authenticator app
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.MFACodeRequest true "TOTP code"
+// @Success 200 {object} map[string]string "MFA enabled"
+// @Failure 400 {object} map[string]string "Bad request - validation error, no pending enrollment or invalid code"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Router /api/profile/mfa/totp/confirm [post]
+func (h *MFAHandler) ConfirmTOTP(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required,len=6,numeric"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	if err := h.service.ConfirmEnrollment(userID, input.Code); err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, mfaErrorMessage(err), err), h.log)
+		return
+	}
+	h.log.WithField("user_id", userID).Info("MFA enabled")
+	c.JSON(http.StatusOK, gin.H{"message": "MFA enabled"})
+}
+
+// DisableTOTP godoc
+// @Summary Disable TOTP
+// @Description Disable two-factor authentication. Requires a current code from the authenticator app
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.MFACodeRequest true "TOTP code"
+// @Success 200 {object} map[string]string "MFA disabled"
+// @Failure 400 {object} map[string]string "Bad request - validation error, MFA not enabled or invalid code"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Router /api/profile/mfa/totp [delete]
+func (h *MFAHandler) DisableTOTP(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required,len=6,numeric"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	if err := h.service.Disable(userID, input.Code); err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, mfaErrorMessage(err), err), h.log)
+		return
+	}
+	h.log.WithField("user_id", userID).Info("MFA disabled")
+	c.JSON(http.StatusOK, gin.H{"message": "MFA disabled"})
+}
+
+func mfaErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, service.ErrMFANotEnrolled):
+		return "MFA is not enrolled"
+	case errors.Is(err, service.ErrInvalidMFACode):
+		return "Invalid MFA code"
+	default:
+		return "MFA update failed"
+	}
+}
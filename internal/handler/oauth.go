@@ -0,0 +1,318 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shahariaz/gin-auth-service/internal/errs"
+	"github.com/shahariaz/gin-auth-service/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+type OAuthHandler struct {
+	service     *service.OAuthService
+	frontendURL string
+	log         *logrus.Logger
+}
+
+func NewOAuthHandler(svc *service.OAuthService, frontendURL string, log *logrus.Logger) *OAuthHandler {
+	return &OAuthHandler{service: svc, frontendURL: frontendURL, log: log}
+}
+
+// authorizeInput binds the authorization request parameters from the query string or a JSON body
+type authorizeInput struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientID            string `form:"client_id" json:"client_id" binding:"required"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri" binding:"required"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	Nonce               string `form:"nonce" json:"nonce"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+func (in authorizeInput) request() service.AuthorizationRequest {
+	return service.AuthorizationRequest{
+		ResponseType:        in.ResponseType,
+		ClientID:            in.ClientID,
+		RedirectURI:         in.RedirectURI,
+		Scope:               in.Scope,
+		State:               in.State,
+		Nonce:               in.Nonce,
+		CodeChallenge:       in.CodeChallenge,
+		CodeChallengeMethod: in.CodeChallengeMethod,
+	}
+}
+
+// Authorize godoc
+// @Summary OAuth 2.0 authorization endpoint
+// @Description Start the authorization code flow. Valid requests are redirected to the login UI at FRONTEND_URL/oauth/authorize with the same parameters, which approves them through /api/oauth/authorize once the user is logged in. PKCE (S256) is required
+// @Tags OAuth
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "Registered redirect URI, matched exactly"
+// @Param scope query string false "Space separated scopes, defaults to all scopes allowed for the client"
+// @Param state query string false "Opaque value returned to the client"
+// @Param nonce query string false "Value echoed in the ID token"
+// @Param code_challenge query string true "PKCE code challenge"
+// @Param code_challenge_method query string true "Must be S256"
+// @Success 302 "Redirect to the login UI, or to the client with an error"
+// @Failure 400 {object} map[string]string "Unknown client or unregistered redirect URI"
+// @Router /oauth/authorize [get]
+func (h *OAuthHandler) Authorize(c *gin.Context) {
+	var input authorizeInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	errorRedirect, err := h.service.CheckAuthorization(input.request())
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid client or redirect URI", err), h.log)
+		return
+	}
+	if errorRedirect != "" {
+		c.Redirect(http.StatusFound, errorRedirect)
+		return
+	}
+	c.Redirect(http.StatusFound, h.frontendURL+"/oauth/authorize?"+c.Request.URL.RawQuery)
+}
+
+// GetConsent godoc
+// @Summary Describe an OAuth authorization request
+// @Description Called by the login UI for the logged-in user with the parameters received at /oauth/authorize. Returns the client and scopes to show on the consent screen, and whether consent is required (it is not when a prior grant covers the requested scopes). Requests that must be reported to the client return redirect_to instead
+// @Tags OAuth
+// @Produce json
+// @Security BearerAuth
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "Registered redirect URI"
+// @Param scope query string false "Space separated scopes"
+// @Param state query string false "Opaque value returned to the client"
+// @Param nonce query string false "Value echoed in the ID token"
+// @Param code_challenge query string true "PKCE code challenge"
+// @Param code_challenge_method query string true "Must be S256"
+// @Success 200 {object} service.ConsentPrompt "Consent screen details"
+// @Failure 400 {object} map[string]string "Unknown client or unregistered redirect URI"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Router /api/oauth/authorize [get]
+func (h *OAuthHandler) GetConsent(c *gin.Context) {
+	var input authorizeInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	prompt, err := h.service.Consent(c.GetUint("user_id"), input.request())
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid client or redirect URI", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, prompt)
+}
+
+// ApproveAuthorization godoc
+// @Summary Answer an OAuth authorization request
+// @Description Called by the login UI for the logged-in user with the parameters received at /oauth/authorize and the user's consent decision. Approving records the granted scopes; without a decision the request only succeeds if a prior grant covers the scopes (else consent_required). Returns the client redirect URI carrying a single-use authorization code (or an error)
+// @Tags OAuth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.OAuthAuthorizeRequest true "Authorization request parameters"
+// @Success 200 {object} map[string]string "URI to redirect the user to"
+// @Failure 400 {object} map[string]string "Unknown client or unregistered redirect URI"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Router /api/oauth/authorize [post]
+func (h *OAuthHandler) ApproveAuthorization(c *gin.Context) {
+	var input struct {
+		authorizeInput
+		Approve *bool `json:"approve"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	redirectTo, err := h.service.Authorize(c.GetUint("user_id"), c.GetString("session_id"), input.request(), input.Approve)
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid client or redirect URI", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"redirect_to": redirectTo})
+}
+
+// Token godoc
+// @Summary OAuth 2.0 token endpoint
+// @Description Exchange an authorization code (with its PKCE code_verifier) or a refresh token for tokens, obtain a client token with client_credentials, poll for a device authorization (authorization_pending, slow_down, access_denied and expired_token until approved), or exchange a user's access token for a down-scoped token addressed to another audience (RFC 8693). Confidential clients authenticate with HTTP Basic or client_secret in the body. Errors use the RFC 6749 format
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code, refresh_token, client_credentials, urn:ietf:params:oauth:grant-type:device_code or urn:ietf:params:oauth:grant-type:token-exchange"
+// @Param client_id formData string false "Client ID, unless sent with HTTP Basic"
+// @Param client_secret formData string false "Client secret of confidential clients"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI used in the authorization request"
+// @Param code_verifier formData string false "PKCE code verifier"
+// @Param refresh_token formData string false "Refresh token"
+// @Param device_code formData string false "Device code from /oauth/device_authorization"
+// @Param scope formData string false "Space separated scopes for client_credentials and token exchange, defaults to all allowed scopes"
+// @Param subject_token formData string false "Access token to exchange"
+// @Param subject_token_type formData string false "urn:ietf:params:oauth:token-type:access_token"
+// @Param audience formData string false "Audience of the exchanged token, must be allowed for the client"
+// @Param requested_token_type formData string false "urn:ietf:params:oauth:token-type:access_token"
+// @Success 200 {object} service.TokenResponse "Tokens issued"
+// @Failure 400 {object} map[string]string "OAuth error"
+// @Failure 401 {object} map[string]string "Client authentication failed"
+// @Router /oauth/token [post]
+func (h *OAuthHandler) Token(c *gin.Context) {
+	var input struct {
+		GrantType    string `form:"grant_type" binding:"required"`
+		ClientID     string `form:"client_id"`
+		ClientSecret string `form:"client_secret"`
+		Code         string `form:"code"`
+		RedirectURI  string `form:"redirect_uri"`
+		CodeVerifier string `form:"code_verifier"`
+		RefreshToken string `form:"refresh_token"`
+		DeviceCode   string `form:"device_code"`
+		Scope        string `form:"scope"`
+
+		SubjectToken       string `form:"subject_token"`
+		SubjectTokenType   string `form:"subject_token_type"`
+		Audience           string `form:"audience"`
+		RequestedTokenType string `form:"requested_token_type"`
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	if err := c.ShouldBind(&input); err != nil {
+		respondOAuthError(c, &service.OAuthError{Code: "invalid_request", Description: "grant_type is required"}, h.log)
+		return
+	}
+
+	clientID, clientSecret := clientCredentials(c, input.ClientID, input.ClientSecret)
+
+	tokens, err := h.service.Token(service.TokenRequest{
+		GrantType:    input.GrantType,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Code:         input.Code,
+		RedirectURI:  input.RedirectURI,
+		CodeVerifier: input.CodeVerifier,
+		RefreshToken: input.RefreshToken,
+		DeviceCode:   input.DeviceCode,
+		Scope:        input.Scope,
+
+		SubjectToken:       input.SubjectToken,
+		SubjectTokenType:   input.SubjectTokenType,
+		Audience:           input.Audience,
+		RequestedTokenType: input.RequestedTokenType,
+	}, sessionInfo(c, ""))
+	if err != nil {
+		respondOAuthError(c, err, h.log)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Introspect godoc
+// @Summary OAuth 2.0 token introspection
+// @Description Report whether an access or refresh token is active (RFC 7662), taking revocations into account. Requires a confidential client; refresh tokens are only described to the client they were issued to
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Token to introspect"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Param client_id formData string false "Client ID, unless sent with HTTP Basic"
+// @Param client_secret formData string false "Client secret, unless sent with HTTP Basic"
+// @Success 200 {object} service.IntrospectionResponse "Token status"
+// @Failure 400 {object} map[string]string "OAuth error"
+// @Failure 401 {object} map[string]string "Client authentication failed"
+// @Router /oauth/introspect [post]
+func (h *OAuthHandler) Introspect(c *gin.Context) {
+	var input struct {
+		Token         string `form:"token" binding:"required"`
+		TokenTypeHint string `form:"token_type_hint"`
+		ClientID      string `form:"client_id"`
+		ClientSecret  string `form:"client_secret"`
+	}
+	c.Header("Cache-Control", "no-store")
+	if err := c.ShouldBind(&input); err != nil {
+		respondOAuthError(c, &service.OAuthError{Code: "invalid_request", Description: "token is required"}, h.log)
+		return
+	}
+
+	clientID, clientSecret := clientCredentials(c, input.ClientID, input.ClientSecret)
+	response, err := h.service.Introspect(clientID, clientSecret, input.Token, input.TokenTypeHint)
+	if err != nil {
+		respondOAuthError(c, err, h.log)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Revoke godoc
+// @Summary OAuth 2.0 token revocation
+// @Description Revoke an access or refresh token issued to the calling client (RFC 7009). Revoking a refresh token ends its session. Unknown or already invalid tokens are accepted
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Token to revoke"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Param client_id formData string false "Client ID, unless sent with HTTP Basic"
+// @Param client_secret formData string false "Client secret of confidential clients"
+// @Success 200 "Token revoked or already invalid"
+// @Failure 400 {object} map[string]string "OAuth error"
+// @Failure 401 {object} map[string]string "Client authentication failed"
+// @Router /oauth/revoke [post]
+func (h *OAuthHandler) Revoke(c *gin.Context) {
+	var input struct {
+		Token         string `form:"token" binding:"required"`
+		TokenTypeHint string `form:"token_type_hint"`
+		ClientID      string `form:"client_id"`
+		ClientSecret  string `form:"client_secret"`
+	}
+	if err := c.ShouldBind(&input); err != nil {
+		respondOAuthError(c, &service.OAuthError{Code: "invalid_request", Description: "token is required"}, h.log)
+		return
+	}
+
+	clientID, clientSecret := clientCredentials(c, input.ClientID, input.ClientSecret)
+	if err := h.service.Revoke(clientID, clientSecret, input.Token, input.TokenTypeHint); err != nil {
+		respondOAuthError(c, err, h.log)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// clientCredentials returns the client authentication of a request to an OAuth endpoint:
+// HTTP Basic (client_secret_basic) if present, else the form parameters (client_secret_post).
+func clientCredentials(c *gin.Context, clientID, clientSecret string) (string, string) {
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(id)
+		clientSecret, _ = url.QueryUnescape(secret)
+	}
+	return clientID, clientSecret
+}
+
+// respondOAuthError writes an error in the RFC 6749 format expected by OAuth clients.
+func respondOAuthError(c *gin.Context, err error, log *logrus.Logger) {
+	var oerr *service.OAuthError
+	if !errors.As(err, &oerr) {
+		log.WithError(err).Error("OAuth server error")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	status := http.StatusBadRequest
+	switch oerr.Code {
+	case "invalid_client":
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	case "invalid_token":
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	log.WithError(err).Warn("OAuth request rejected")
+	c.JSON(status, gin.H{"error": oerr.Code, "error_description": oerr.Description})
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shahariaz/gin-auth-service/internal/errs"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/shahariaz/gin-auth-service/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+type OAuthClientHandler struct {
+	service *service.OAuthClientService
+	logouts *service.BackchannelLogoutService
+	log     *logrus.Logger
+}
+
+func NewOAuthClientHandler(svc *service.OAuthClientService, logouts *service.BackchannelLogoutService, log *logrus.Logger) *OAuthClientHandler {
+	return &OAuthClientHandler{service: svc, logouts: logouts, log: log}
+}
+
+// CreateClient godoc
+// @Summary Register an OAuth client (Admin only)
+// @Description Register an application for the OAuth endpoints. The client_secret of confidential clients is only returned here. Only confidential clients may use the client_credentials and token exchange grants
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.CreateOAuthClientRequest true "Client registration"
+// @Success 201 {object} map[string]interface{} "Client registered"
+// @Failure 400 {object} map[string]string "Bad request - validation error"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 403 {object} map[string]string "Forbidden - admin role required"
+// @Router /api/admin/oauth/clients [post]
+func (h *OAuthClientHandler) CreateClient(c *gin.Context) {
+	var input struct {
+		Name             string   `json:"name" binding:"required,max=100"`
+		Type             string   `json:"type" binding:"required,oneof=public confidential"`
+		RedirectURIs     []string `json:"redirect_uris" binding:"omitempty,dive,url"`
+		AllowedScopes    []string `json:"allowed_scopes" binding:"required,min=1"`
+		GrantTypes       []string `json:"grant_types" binding:"omitempty,dive,oneof=authorization_code refresh_token client_credentials urn:ietf:params:oauth:grant-type:device_code urn:ietf:params:oauth:grant-type:token-exchange"`
+		AllowedAudiences []string `json:"allowed_audiences"`
+		LogoutURI        string   `json:"backchannel_logout_uri" binding:"omitempty,url"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	client, secret, err := h.service.Create(service.ClientRegistration{
+		Name:             input.Name,
+		Type:             input.Type,
+		RedirectURIs:     input.RedirectURIs,
+		AllowedScopes:    input.AllowedScopes,
+		GrantTypes:       input.GrantTypes,
+		AllowedAudiences: input.AllowedAudiences,
+		LogoutURI:        input.LogoutURI,
+	})
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, err.Error(), err), h.log)
+		return
+	}
+
+	h.log.WithFields(logrus.Fields{"client_id": client.ClientID, "by": c.GetString("user")}).Info("OAuth client registered")
+	response := gin.H{"client": client}
+	if secret != "" {
+		response["client_secret"] = secret
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// ListClients godoc
+// @Summary List OAuth clients (Admin only)
+// @Description List registered OAuth clients, optionally filtered by status (pending clients are waiting for approval)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "pending, active or disabled"
+// @Success 200 {object} map[string]interface{} "Clients retrieved successfully"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 403 {object} map[string]string "Forbidden - admin role required"
+// @Router /api/admin/oauth/clients [get]
+func (h *OAuthClientHandler) ListClients(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && status != model.OAuthClientPending && status != model.OAuthClientActive && status != model.OAuthClientDisabled {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid status", nil), h.log)
+		return
+	}
+	clients, err := h.service.List(status)
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to list clients", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"clients": clients})
+}
+
+// ListLogoutDeliveries godoc
+// @Summary List back-channel logout deliveries (Admin only)
+// @Description List the most recent logout notifications sent to OAuth clients, optionally filtered by status. Pending deliveries are retried with backoff; failed ones ran out of attempts
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "pending, delivered or failed"
+// @Success 200 {object} map[string]interface{} "Deliveries retrieved successfully"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 403 {object} map[string]string "Forbidden - admin role required"
+// @Router /api/admin/oauth/logout-deliveries [get]
+func (h *OAuthClientHandler) ListLogoutDeliveries(c *gin.Context) {
+	deliveries, err := h.logouts.List(c.Query("status"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to list deliveries", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// ApproveClient godoc
+// @Summary Approve an OAuth client (Admin only)
+// @Description Activate a self-registered client, or re-enable a disabled one
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Client record ID"
+// @Success 200 {object} map[string]interface{} "Client approved"
+// @Failure 400 {object} map[string]string "Bad request - invalid ID"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 403 {object} map[string]string "Forbidden - admin role required"
+// @Failure 404 {object} map[string]string "Client not found"
+// @Router /api/admin/oauth/clients/{id}/approve [post]
+func (h *OAuthClientHandler) ApproveClient(c *gin.Context) {
+	h.setStatus(c, model.OAuthClientActive, "OAuth client approved")
+}
+
+// DisableClient godoc
+// @Summary Disable an OAuth client (Admin only)
+// @Description Block a client from the OAuth endpoints. Tokens it already holds stay valid until they expire
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Client record ID"
+// @Success 200 {object} map[string]interface{} "Client disabled"
+// @Failure 400 {object} map[string]string "Bad request - invalid ID"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 403 {object} map[string]string "Forbidden - admin role required"
+// @Failure 404 {object} map[string]string "Client not found"
+// @Router /api/admin/oauth/clients/{id}/disable [post]
+func (h *OAuthClientHandler) DisableClient(c *gin.Context) {
+	h.setStatus(c, model.OAuthClientDisabled, "OAuth client disabled")
+}
+
+// DeleteClient godoc
+// @Summary Delete an OAuth client (Admin only)
+// @Description Remove a registered OAuth client
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Client record ID"
+// @Success 200 {object} map[string]string "Client deleted"
+// @Failure 400 {object} map[string]string "Bad request - invalid ID"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 403 {object} map[string]string "Forbidden - admin role required"
+// @Failure 404 {object} map[string]string "Client not found"
+// @Router /api/admin/oauth/clients/{id} [delete]
+func (h *OAuthClientHandler) DeleteClient(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid client ID", err), h.log)
+		return
+	}
+	if err := h.service.Delete(uint(id)); err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusNotFound, "Client not found", err), h.log)
+		return
+	}
+	h.log.WithField("id", id).Info("OAuth client deleted")
+	c.JSON(http.StatusOK, gin.H{"message": "Client deleted"})
+}
+
+func (h *OAuthClientHandler) setStatus(c *gin.Context, status, message string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid client ID", err), h.log)
+		return
+	}
+	client, err := h.service.SetStatus(uint(id), status)
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusNotFound, "Client not found", err), h.log)
+		return
+	}
+	h.log.WithFields(logrus.Fields{"client_id": client.ClientID, "by": c.GetString("user")}).Info(message)
+	c.JSON(http.StatusOK, gin.H{"client": client})
+}
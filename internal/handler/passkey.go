@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shahariaz/gin-auth-service/internal/errs"
+	"github.com/shahariaz/gin-auth-service/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+type PasskeyHandler struct {
+	service *service.PasskeyService
+	auth    *service.AuthService
+	log     *logrus.Logger
+}
+
+func NewPasskeyHandler(svc *service.PasskeyService, auth *service.AuthService, log *logrus.Logger) *PasskeyHandler {
+	return &PasskeyHandler{service: svc, auth: auth, log: log}
+}
+
+// BeginRegistration godoc
+// @Summary Begin passkey registration
+// @Description Start a WebAuthn registration ceremony. Pass the returned options to navigator.credentials.create() and send the result with the ceremony_id to the finish endpoint
+// @Tags Passkeys
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Ceremony ID and credential creation options"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/profile/passkeys/register/begin [post]
+func (h *PasskeyHandler) BeginRegistration(c *gin.Context) {
+	options, ceremonyID, err := h.service.BeginRegistration(c.GetUint("user_id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to start passkey registration", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ceremony_id": ceremonyID, "options": options})
+}
+
+// FinishRegistration godoc
+// @Summary Finish passkey registration
+// @Description Verify the authenticator response and store the new passkey
+// @Tags Passkeys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.PasskeyRegistrationRequest true "Registration ceremony response"
+// @Success 201 {object} map[string]interface{} "Passkey registered"
+// @Failure 400 {object} map[string]string "Bad request - validation error or verification failed"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Router /api/profile/passkeys/register/finish [post]
+func (h *PasskeyHandler) FinishRegistration(c *gin.Context) {
+	var input struct {
+		CeremonyID string          `json:"ceremony_id" binding:"required"`
+		Name       string          `json:"name" binding:"max=100"`
+		Credential json.RawMessage `json:"credential" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	passkey, err := h.service.FinishRegistration(userID, input.CeremonyID, input.Name, input.Credential)
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Passkey registration failed", err), h.log)
+		return
+	}
+	h.log.WithField("user_id", userID).Info("Passkey registered")
+	c.JSON(http.StatusCreated, gin.H{"message": "Passkey registered", "passkey": passkey})
+}
+
+// ListPasskeys godoc
+// @Summary List passkeys
+// @Description List the authenticated user's registered passkeys
+// @Tags Passkeys
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Passkeys retrieved successfully"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/profile/passkeys [get]
+func (h *PasskeyHandler) ListPasskeys(c *gin.Context) {
+	passkeys, err := h.service.List(c.GetUint("user_id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to list passkeys", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"passkeys": passkeys})
+}
+
+// DeletePasskey godoc
+// @Summary Delete a passkey
+// @Description Remove one of the authenticated user's passkeys. The last remaining login method cannot be removed
+// @Tags Passkeys
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Passkey ID"
+// @Success 200 {object} map[string]string "Passkey deleted"
+// @Failure 400 {object} map[string]string "Bad request - invalid passkey ID"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 404 {object} map[string]string "Passkey not found"
+// @Failure 409 {object} map[string]string "Passkey is the last login method"
+// @Router /api/profile/passkeys/{id} [delete]
+func (h *PasskeyHandler) DeletePasskey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid passkey ID", err), h.log)
+		return
+	}
+	userID := c.GetUint("user_id")
+	err = h.service.Delete(userID, uint(id))
+	if errors.Is(err, service.ErrLastLoginMethod) {
+		errs.HandleError(c, errs.NewAPIError(http.StatusConflict, err.Error(), err), h.log)
+		return
+	}
+	if errors.Is(err, service.ErrPasskeyNotFound) {
+		errs.HandleError(c, errs.NewAPIError(http.StatusNotFound, "Passkey not found", err), h.log)
+		return
+	}
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to delete passkey", err), h.log)
+		return
+	}
+	h.log.WithFields(logrus.Fields{"user_id": userID, "passkey_id": id}).Info("Passkey deleted")
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey deleted"})
+}
+
+// BeginLogin godoc
+// @Summary Begin passkey login
+// @Description Start a passwordless WebAuthn login ceremony. Pass the returned options to navigator.credentials.get() and send the result with the ceremony_id to the finish endpoint
+// @Tags Authentication
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Ceremony ID and credential request options"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /login/passkey/begin [post]
+func (h *PasskeyHandler) BeginLogin(c *gin.Context) {
+	options, ceremonyID, err := h.service.BeginLogin()
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to start passkey login", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ceremony_id": ceremonyID, "options": options})
+}
+
+// FinishLogin godoc
+// @Summary Finish passkey login
+// @Description Verify the passkey assertion and return access and refresh tokens. If MFA is enabled, returns mfa_required and an mfa_token for /login/mfa instead
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body model.PasskeyLoginRequest true "Login ceremony response"
+// @Success 200 {object} map[string]interface{} "Login successful with tokens and user info, or MFA challenge"
+// @Failure 400 {object} map[string]string "Bad request - validation error"
+// @Failure 401 {object} map[string]string "Unauthorized - passkey verification failed"
+// @Failure 403 {object} map[string]string "Forbidden - email address not verified"
+// @Router /login/passkey/finish [post]
+func (h *PasskeyHandler) FinishLogin(c *gin.Context) {
+	var input struct {
+		CeremonyID string          `json:"ceremony_id" binding:"required"`
+		DeviceName string          `json:"device_name" binding:"max=255"`
+		Credential json.RawMessage `json:"credential" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	user, err := h.service.FinishLogin(input.CeremonyID, input.Credential)
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusUnauthorized, "Passkey verification failed", err), h.log)
+		return
+	}
+
+	result, err := h.auth.CompleteLogin(&service.Principal{User: user, Method: service.MethodPasskey}, sessionInfo(c, input.DeviceName))
+	if errors.Is(err, service.ErrEmailNotVerified) {
+		errs.HandleError(c, errs.NewAPIError(http.StatusForbidden, "Email address not verified", err), h.log)
+		return
+	}
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to start session", err), h.log)
+		return
+	}
+	respondLogin(c, result, h.log)
+}
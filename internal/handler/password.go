@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shahariaz/gin-auth-service/internal/errs"
+	"github.com/shahariaz/gin-auth-service/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+type PasswordHandler struct {
+	service *service.PasswordService
+	log     *logrus.Logger
+}
+
+func NewPasswordHandler(svc *service.PasswordService, log *logrus.Logger) *PasswordHandler {
+	return &PasswordHandler{service: svc, log: log}
+}
+
+// ForgotPassword godoc
+// @Summary Request password reset
+// @Description Email a single-use password reset link. The response is the same whether or not the account exists
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body model.ForgotPasswordRequest true "Email address"
+// @Success 200 {object} map[string]string "Request accepted"
+// @Failure 400 {object} map[string]string "Bad request - validation error"
+// @Router /password/forgot [post]
+func (h *PasswordHandler) ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	if err := h.service.RequestReset(input.Email); err != nil {
+		// Logged only: failing the request would reveal that the account exists
+		h.log.WithError(err).Error("Failed to create password reset")
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists, a password reset email has been sent"})
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password with the token from the reset email. All sessions of the user are revoked
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body model.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]string "Password reset"
+// @Failure 400 {object} map[string]string "Bad request - validation error or invalid, expired or used token"
+// @Router /password/reset [post]
+func (h *PasswordHandler) ResetPassword(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=8"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	user, err := h.service.ResetPassword(input.Token, input.Password)
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid or expired reset token", err), h.log)
+		return
+	}
+
+	h.log.WithField("username", user.Username).Info("Password reset")
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Change the authenticated user's password. Requires the current password; every other session is signed out while the current one stays active
+// @Tags User Profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} map[string]string "Password changed"
+// @Failure 400 {object} map[string]string "Bad request - validation error or password change failed"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid token or incorrect current password"
+// @Router /api/profile/password [put]
+func (h *PasswordHandler) ChangePassword(c *gin.Context) {
+	var input struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required,min=8"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	err := h.service.ChangePassword(userID, c.GetString("session_id"), input.CurrentPassword, input.NewPassword)
+	if errors.Is(err, service.ErrInvalidCurrentPassword) {
+		errs.HandleError(c, errs.NewAPIError(http.StatusUnauthorized, "Current password is incorrect", err), h.log)
+		return
+	}
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Password change failed", err), h.log)
+		return
+	}
+
+	h.log.WithField("user_id", userID).Info("Password changed")
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed, other sessions have been signed out"})
+}
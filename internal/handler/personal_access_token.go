@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shahariaz/gin-auth-service/internal/errs"
+	"github.com/shahariaz/gin-auth-service/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+type PersonalAccessTokenHandler struct {
+	service *service.PersonalAccessTokenService
+	log     *logrus.Logger
+}
+
+func NewPersonalAccessTokenHandler(svc *service.PersonalAccessTokenService, log *logrus.Logger) *PersonalAccessTokenHandler {
+	return &PersonalAccessTokenHandler{service: svc, log: log}
+}
+
+// CreateToken godoc
+// @Summary Create a personal access token
+// @Description Create a long-lived token to call the API as the authenticated user, sent as "Authorization: Bearer pat_...". The token is only returned here. Without scopes it has the user's full access; read allows safe methods, write all methods and admin the admin routes (admins only). Only first-party session tokens can create them: not personal access tokens, nor tokens issued to OAuth clients or obtained by token exchange
+// @Tags Personal Access Tokens
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body model.CreatePersonalAccessTokenRequest true "Token name, lifetime and scopes"
+// @Success 201 {object} map[string]interface{} "Token created"
+// @Failure 400 {object} map[string]string "Bad request - validation error"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 403 {object} map[string]string "Forbidden - not a first-party session token"
+// @Router /api/profile/tokens [post]
+func (h *PersonalAccessTokenHandler) CreateToken(c *gin.Context) {
+	// A token outlives the session and any OAuth grant, so only the user's own login may create one
+	_, delegated := c.Get("actor")
+	if c.GetUint("personal_access_token_id") != 0 || c.GetString("client_id") != "" || delegated {
+		errs.HandleError(c, errs.NewAPIError(http.StatusForbidden, "Personal access tokens can only be created from a first-party session", nil), h.log)
+		return
+	}
+	var input struct {
+		Name          string   `json:"name" binding:"required,max=100"`
+		ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+		Scopes        []string `json:"scopes" binding:"omitempty,dive,oneof=read write admin"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	ttl := time.Duration(input.ExpiresInDays) * 24 * time.Hour
+	record, token, err := h.service.Create(c.GetUint("user_id"), c.GetString("role"), input.Name, input.Scopes, ttl)
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, err.Error(), err), h.log)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"token": token, "personal_access_token": record})
+}
+
+// ListTokens godoc
+// @Summary List personal access tokens
+// @Description List the authenticated user's personal access tokens with their scopes, expiry and last use. The tokens themselves are not shown
+// @Tags Personal Access Tokens
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Tokens retrieved successfully"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/profile/tokens [get]
+func (h *PersonalAccessTokenHandler) ListTokens(c *gin.Context) {
+	tokens, err := h.service.List(c.GetUint("user_id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to list tokens", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"personal_access_tokens": tokens})
+}
+
+// RevokeToken godoc
+// @Summary Revoke a personal access token
+// @Description Revoke one of the authenticated user's personal access tokens
+// @Tags Personal Access Tokens
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Token ID"
+// @Success 200 {object} map[string]string "Token revoked"
+// @Failure 400 {object} map[string]string "Bad request - invalid token ID"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 404 {object} map[string]string "Token not found"
+// @Router /api/profile/tokens/{id} [delete]
+func (h *PersonalAccessTokenHandler) RevokeToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid token ID", err), h.log)
+		return
+	}
+	h.revoke(c, c.GetUint("user_id"), uint(id))
+}
+
+// ListUserTokens godoc
+// @Summary List a user's personal access tokens (Admin only)
+// @Description List the personal access tokens of any user (requires admin role)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{} "Tokens retrieved successfully"
+// @Failure 400 {object} map[string]string "Bad request - invalid user ID"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 403 {object} map[string]string "Forbidden - admin role required"
+// @Router /api/admin/users/{id}/tokens [get]
+func (h *PersonalAccessTokenHandler) ListUserTokens(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid user ID", err), h.log)
+		return
+	}
+	tokens, err := h.service.List(uint(id))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to list tokens", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"personal_access_tokens": tokens})
+}
+
+// RevokeUserToken godoc
+// @Summary Revoke a user's personal access token (Admin only)
+// @Description Revoke a personal access token of any user (requires admin role)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param token_id path int true "Token ID"
+// @Success 200 {object} map[string]string "Token revoked"
+// @Failure 400 {object} map[string]string "Bad request - invalid user or token ID"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 403 {object} map[string]string "Forbidden - admin role required"
+// @Failure 404 {object} map[string]string "Token not found"
+// @Router /api/admin/users/{id}/tokens/{token_id} [delete]
+func (h *PersonalAccessTokenHandler) RevokeUserToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid user ID", err), h.log)
+		return
+	}
+	tokenID, err := strconv.Atoi(c.Param("token_id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid token ID", err), h.log)
+		return
+	}
+	h.revoke(c, uint(id), uint(tokenID))
+}
+
+func (h *PersonalAccessTokenHandler) revoke(c *gin.Context, userID, id uint) {
+	err := h.service.Revoke(userID, id)
+	if errors.Is(err, service.ErrPersonalAccessTokenNotFound) {
+		errs.HandleError(c, errs.NewAPIError(http.StatusNotFound, "Token not found", err), h.log)
+		return
+	}
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to revoke token", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
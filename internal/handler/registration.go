@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/shahariaz/gin-auth-service/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+type RegistrationHandler struct {
+	service *service.OAuthClientService
+	issuer  string
+	log     *logrus.Logger
+}
+
+func NewRegistrationHandler(svc *service.OAuthClientService, issuer string, log *logrus.Logger) *RegistrationHandler {
+	return &RegistrationHandler{service: svc, issuer: issuer, log: log}
+}
+
+// Register godoc
+// @Summary Dynamic client registration
+// @Description Register an OAuth client (RFC 7591) with the initial access token as Bearer token. The client stays pending until an admin approves it. The response carries the client_secret (unless token_endpoint_auth_method is none) and a registration_access_token for managing the registration; both are only returned here
+// @Tags OAuth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.ClientMetadata true "Client metadata"
+// @Success 201 {object} service.ClientInformation "Client registered"
+// @Failure 400 {object} map[string]string "invalid_client_metadata"
+// @Failure 401 {object} map[string]string "invalid_token"
+// @Router /oauth/register [post]
+func (h *RegistrationHandler) Register(c *gin.Context) {
+	var input service.ClientMetadata
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondOAuthError(c, &service.OAuthError{Code: "invalid_client_metadata", Description: "Malformed client metadata"}, h.log)
+		return
+	}
+
+	client, secret, registrationToken, err := h.service.Register(bearerToken(c), input)
+	if err != nil {
+		respondOAuthError(c, err, h.log)
+		return
+	}
+	info := h.clientInformation(client)
+	info.ClientSecret = secret
+	info.RegistrationAccessToken = registrationToken
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, info)
+}
+
+// GetRegistration godoc
+// @Summary Read a client registration
+// @Description Read the metadata and status of a self-registered client (RFC 7592), authenticated with its registration access token
+// @Tags OAuth
+// @Produce json
+// @Security BearerAuth
+// @Param client_id path string true "Client ID"
+// @Success 200 {object} service.ClientInformation "Client registration"
+// @Failure 401 {object} map[string]string "invalid_token"
+// @Router /oauth/register/{client_id} [get]
+func (h *RegistrationHandler) GetRegistration(c *gin.Context) {
+	client, err := h.service.Registration(c.Param("client_id"), bearerToken(c))
+	if err != nil {
+		respondOAuthError(c, err, h.log)
+		return
+	}
+	c.JSON(http.StatusOK, h.clientInformation(client))
+}
+
+// UpdateRegistration godoc
+// @Summary Update a client registration
+// @Description Replace the metadata of a self-registered client (RFC 7592). Adding redirect URIs, scopes or grant types to an approved client sends it back for approval
+// @Tags OAuth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param client_id path string true "Client ID"
+// @Param request body service.ClientMetadata true "Client metadata"
+// @Success 200 {object} service.ClientInformation "Client registration updated"
+// @Failure 400 {object} map[string]string "invalid_client_metadata"
+// @Failure 401 {object} map[string]string "invalid_token"
+// @Router /oauth/register/{client_id} [put]
+func (h *RegistrationHandler) UpdateRegistration(c *gin.Context) {
+	var input service.ClientMetadata
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondOAuthError(c, &service.OAuthError{Code: "invalid_client_metadata", Description: "Malformed client metadata"}, h.log)
+		return
+	}
+
+	client, err := h.service.UpdateRegistration(c.Param("client_id"), bearerToken(c), input)
+	if err != nil {
+		respondOAuthError(c, err, h.log)
+		return
+	}
+	c.JSON(http.StatusOK, h.clientInformation(client))
+}
+
+// DeleteRegistration godoc
+// @Summary Delete a client registration
+// @Description Remove a self-registered client (RFC 7592)
+// @Tags OAuth
+// @Security BearerAuth
+// @Param client_id path string true "Client ID"
+// @Success 204 "Client deleted"
+// @Failure 401 {object} map[string]string "invalid_token"
+// @Router /oauth/register/{client_id} [delete]
+func (h *RegistrationHandler) DeleteRegistration(c *gin.Context) {
+	if err := h.service.DeleteRegistration(c.Param("client_id"), bearerToken(c)); err != nil {
+		respondOAuthError(c, err, h.log)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *RegistrationHandler) clientInformation(client *model.OAuthClient) *service.ClientInformation {
+	return service.NewClientInformation(client, h.issuer+"/oauth/register/"+client.ClientID)
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header, or "" without one.
+func bearerToken(c *gin.Context) string {
+	auth := c.GetHeader("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+	return strings.TrimPrefix(auth, "Bearer ")
+}
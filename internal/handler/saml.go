@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shahariaz/gin-auth-service/internal/errs"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+const samlLoginCookie = "saml_login"
+
+type SAMLHandler struct {
+	service *service.SAMLService
+	auth    *service.AuthService
+	log     *logrus.Logger
+}
+
+func NewSAMLHandler(svc *service.SAMLService, auth *service.AuthService, log *logrus.Logger) *SAMLHandler {
+	return &SAMLHandler{service: svc, auth: auth, log: log}
+}
+
+// ListProviders godoc
+// @Summary List SAML identity providers
+// @Description List the SAML 2.0 providers users can sign in with
+// @Tags Authentication
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Configured providers"
+// @Router /login/saml [get]
+func (h *SAMLHandler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.service.Providers()})
+}
+
+// Metadata godoc
+// @Summary SAML service provider metadata
+// @Description Metadata (entity ID, ACS URL and certificate) to register at the identity provider
+// @Tags Authentication
+// @Produce xml
+// @Param provider path string true "Provider name"
+// @Success 200 {string} string "SP metadata"
+// @Failure 404 {object} map[string]string "Unknown provider"
+// @Router /login/saml/{provider}/metadata [get]
+func (h *SAMLHandler) Metadata(c *gin.Context) {
+	metadata, err := h.service.Metadata(c.Param("provider"))
+	if errors.Is(err, service.ErrUnknownProvider) {
+		errs.HandleError(c, errs.NewAPIError(http.StatusNotFound, "Unknown identity provider", err), h.log)
+		return
+	}
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to build metadata", err), h.log)
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+// BeginLogin godoc
+// @Summary Sign in with a SAML identity provider
+// @Description Redirect the browser to the provider with an AuthnRequest (HTTP-Redirect binding). The response is only accepted in the same browser, which receives a binding cookie
+// @Tags Authentication
+// @Param provider path string true "Provider name"
+// @Param device_name query string false "Name of the device, shown in the session list"
+// @Success 302 "Redirect to the provider"
+// @Failure 404 {object} map[string]string "Unknown provider"
+// @Failure 502 {object} map[string]string "Provider unavailable"
+// @Router /login/saml/{provider} [get]
+func (h *SAMLHandler) BeginLogin(c *gin.Context) {
+	var input struct {
+		DeviceName string `form:"device_name" binding:"max=255"`
+	}
+	if err := c.ShouldBindQuery(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	binding, err := lib.NewOpaqueToken()
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Internal server error", err), h.log)
+		return
+	}
+	redirectURL, err := h.service.Begin(c.Param("provider"), binding, input.DeviceName)
+	if errors.Is(err, service.ErrUnknownProvider) {
+		errs.HandleError(c, errs.NewAPIError(http.StatusNotFound, "Unknown identity provider", err), h.log)
+		return
+	}
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadGateway, "Identity provider unavailable", err), h.log)
+		return
+	}
+
+	setSAMLLoginCookie(c, binding)
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// AssertionConsumer godoc
+// @Summary SAML assertion consumer service
+// @Description ACS URL registered at the provider (HTTP-POST binding). Validates the signed response and returns access and refresh tokens (or an MFA challenge). First-time users get an account with the provider's default role, or are linked to the account with the same email if the provider is trusted to verify emails. For a link started from the profile, returns the linked identity instead
+// @Tags Authentication
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param SAMLResponse formData string true "Base64 encoded SAML response"
+// @Param RelayState formData string true "Relay state from the authentication request"
+// @Success 200 {object} map[string]interface{} "Login successful with tokens and user info, MFA challenge, or linked identity"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid response or login failed"
+// @Failure 403 {object} map[string]string "Forbidden - email address not verified"
+// @Failure 409 {object} map[string]string "An account with this email already exists, or the identity is linked to another account"
+// @Router /login/saml/{provider}/acs [post]
+func (h *SAMLHandler) AssertionConsumer(c *gin.Context) {
+	binding, _ := c.Cookie(samlLoginCookie)
+	federated, err := h.service.Complete(c.Param("provider"), c.PostForm("RelayState"), c.PostForm("SAMLResponse"), binding)
+	if errors.Is(err, service.ErrIdentityConflict) || errors.Is(err, service.ErrIdentityLinked) {
+		errs.HandleError(c, errs.NewAPIError(http.StatusConflict, err.Error(), err), h.log)
+		return
+	}
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusUnauthorized, "Login with identity provider failed", err), h.log)
+		return
+	}
+	c.SetCookie(samlLoginCookie, "", -1, "/login/saml", "", true, true)
+
+	if federated.Linked != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Identity linked", "identity": federated.Linked})
+		return
+	}
+	result, err := h.auth.CompleteLogin(federated.Principal, sessionInfo(c, federated.DeviceName))
+	if errors.Is(err, service.ErrEmailNotVerified) {
+		errs.HandleError(c, errs.NewAPIError(http.StatusForbidden, "Email address not verified", err), h.log)
+		return
+	}
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to start session", err), h.log)
+		return
+	}
+	respondLogin(c, result, h.log)
+}
+
+// setSAMLLoginCookie gives the browser the binding secret checked at the ACS.
+func setSAMLLoginCookie(c *gin.Context, binding string) {
+	// The provider posts the response cross-site, so the cookie must be SameSite=None, which
+	// browsers only accept on Secure cookies (http://localhost counts as secure)
+	c.SetSameSite(http.SameSiteNoneMode)
+	c.SetCookie(samlLoginCookie, binding, int(service.FederatedLoginTTL.Seconds()), "/login/saml", "", true, true)
+}
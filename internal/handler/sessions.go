@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shahariaz/gin-auth-service/internal/errs"
+	"github.com/shahariaz/gin-auth-service/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+type SessionHandler struct {
+	service *service.SessionService
+	log     *logrus.Logger
+}
+
+func NewSessionHandler(svc *service.SessionService, log *logrus.Logger) *SessionHandler {
+	return &SessionHandler{service: svc, log: log}
+}
+
+// ListSessions godoc
+// @Summary List active sessions
+// @Description List the authenticated user's active sessions (one per logged-in device). The session of the calling token is flagged as current
+// @Tags Sessions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Sessions retrieved successfully"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/sessions [get]
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	sessions, err := h.service.ListForUser(c.GetUint("user_id"), c.GetString("session_id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to list sessions", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession godoc
+// @Summary Revoke a session
+// @Description Log out one of the authenticated user's devices
+// @Tags Sessions
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Success 200 {object} map[string]string "Session revoked successfully"
+// @Failure 400 {object} map[string]string "Bad request - invalid session ID"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 404 {object} map[string]string "Session not found"
+// @Router /api/sessions/{id} [delete]
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid session ID", err), h.log)
+		return
+	}
+	userID := c.GetUint("user_id")
+	if err := h.service.Revoke(userID, uint(id)); err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusNotFound, "Session not found", err), h.log)
+		return
+	}
+	h.log.WithFields(logrus.Fields{"user_id": userID, "session_id": id}).Info("Session revoked")
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions godoc
+// @Summary Log out everywhere else
+// @Description Revoke every session of the authenticated user except the current one
+// @Tags Sessions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Other sessions revoked successfully"
+// @Failure 400 {object} map[string]string "Bad request - token is not bound to a session"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/sessions/revoke-others [post]
+func (h *SessionHandler) RevokeOtherSessions(c *gin.Context) {
+	current := c.GetString("session_id")
+	if current == "" {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Token is not bound to a session", nil), h.log)
+		return
+	}
+	userID := c.GetUint("user_id")
+	count, err := h.service.RevokeOthers(userID, current)
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to revoke sessions", err), h.log)
+		return
+	}
+	h.log.WithFields(logrus.Fields{"user_id": userID, "revoked": count}).Info("Other sessions revoked")
+	c.JSON(http.StatusOK, gin.H{"message": "Other sessions revoked", "revoked": count})
+}
+
+// ListUserSessions godoc
+// @Summary List a user's sessions (Admin only)
+// @Description List the active sessions of any user (requires admin role)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{} "Sessions retrieved successfully"
+// @Failure 400 {object} map[string]string "Bad request - invalid user ID"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 403 {object} map[string]string "Forbidden - admin role required"
+// @Router /api/admin/users/{id}/sessions [get]
+func (h *SessionHandler) ListUserSessions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid user ID", err), h.log)
+		return
+	}
+	sessions, err := h.service.ListForUser(uint(id), "")
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to list sessions", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeUserSession godoc
+// @Summary Revoke a user's session (Admin only)
+// @Description Log out one device of any user (requires admin role)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param session_id path int true "Session ID"
+// @Success 200 {object} map[string]string "Session revoked successfully"
+// @Failure 400 {object} map[string]string "Bad request - invalid user or session ID"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 403 {object} map[string]string "Forbidden - admin role required"
+// @Failure 404 {object} map[string]string "Session not found"
+// @Router /api/admin/users/{id}/sessions/{session_id} [delete]
+func (h *SessionHandler) RevokeUserSession(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid user ID", err), h.log)
+		return
+	}
+	sessionID, err := strconv.Atoi(c.Param("session_id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid session ID", err), h.log)
+		return
+	}
+	if err := h.service.Revoke(uint(id), uint(sessionID)); err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusNotFound, "Session not found", err), h.log)
+		return
+	}
+	h.log.WithFields(logrus.Fields{"user_id": id, "session_id": sessionID}).Info("Session revoked by admin")
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeUserSessions godoc
+// @Summary Revoke all of a user's sessions (Admin only)
+// @Description Log out every device of any user (requires admin role)
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]interface{} "Sessions revoked successfully"
+// @Failure 400 {object} map[string]string "Bad request - invalid user ID"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 403 {object} map[string]string "Forbidden - admin role required"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/admin/users/{id}/sessions [delete]
+func (h *SessionHandler) RevokeUserSessions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid user ID", err), h.log)
+		return
+	}
+	count, err := h.service.RevokeAll(uint(id))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Failed to revoke sessions", err), h.log)
+		return
+	}
+	h.log.WithFields(logrus.Fields{"user_id": id, "revoked": count}).Info("All sessions revoked by admin")
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "revoked": count})
+}
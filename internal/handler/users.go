@@ -41,6 +41,25 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"user": user})
 }
 
+// UserInfo godoc
+// @Summary OpenID Connect userinfo
+// @Description Standard claims about the user the bearer token was issued to
+// @Tags Discovery
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "User claims"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid or missing token"
+// @Failure 404 {object} map[string]string "User not found"
+// @Router /userinfo [get]
+func (h *UserHandler) UserInfo(c *gin.Context) {
+	info, err := h.service.UserInfo(c.GetUint("user_id"))
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusNotFound, "User not found", err), h.log)
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
 // UpdateProfile godoc
 // @Summary Update user profile
 // @Description Update the authenticated user's profile information
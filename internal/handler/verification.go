@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shahariaz/gin-auth-service/internal/errs"
+	"github.com/shahariaz/gin-auth-service/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+type VerificationHandler struct {
+	service *service.VerificationService
+	log     *logrus.Logger
+}
+
+func NewVerificationHandler(svc *service.VerificationService, log *logrus.Logger) *VerificationHandler {
+	return &VerificationHandler{service: svc, log: log}
+}
+
+// VerifyEmail godoc
+// @Summary Verify email address
+// @Description Confirm ownership of an email address with the single-use token from the verification email
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body model.VerifyEmailRequest true "Verification token"
+// @Success 200 {object} map[string]string "Email verified"
+// @Failure 400 {object} map[string]string "Bad request - invalid, expired or already used token"
+// @Router /verify-email [post]
+func (h *VerificationHandler) VerifyEmail(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	user, err := h.service.Verify(input.Token)
+	if err != nil {
+		errs.HandleError(c, errs.NewAPIError(http.StatusBadRequest, "Invalid or expired verification token", err), h.log)
+		return
+	}
+
+	h.log.WithField("username", user.Username).Info("Email verified")
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// ResendVerification godoc
+// @Summary Resend verification email
+// @Description Send a new verification email. The response is the same whether or not the account exists
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body model.ResendVerificationRequest true "Email address"
+// @Success 200 {object} map[string]string "Request accepted"
+// @Failure 400 {object} map[string]string "Bad request - validation error"
+// @Router /verify-email/resend [post]
+func (h *VerificationHandler) ResendVerification(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		errs.HandleValidationError(c, err, h.log)
+		return
+	}
+
+	if err := h.service.Resend(input.Email); err != nil {
+		// Logged only: failing the request would reveal that the account exists
+		h.log.WithError(err).Error("Failed to resend verification email")
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists and is not verified yet, a verification email has been sent"})
+}
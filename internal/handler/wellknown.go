@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+// jwksMaxAge bounds how long consumers cache the key set. Keep it well below the access token
+// TTL so a newly activated key is picked up before tokens signed with it are common.
+const jwksMaxAge = "public, max-age=300"
+
+type WellKnownHandler struct {
+	keys   *lib.KeySet
+	issuer string
+	log    *logrus.Logger
+}
+
+func NewWellKnownHandler(keys *lib.KeySet, issuer string, log *logrus.Logger) *WellKnownHandler {
+	return &WellKnownHandler{keys: keys, issuer: issuer, log: log}
+}
+
+// OpenIDConfiguration godoc
+// @Summary OpenID Connect discovery
+// @Description OpenID Provider metadata. The issuer matches the iss claim of every token issued by this service
+// @Tags Discovery
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Provider metadata"
+// @Router /.well-known/openid-configuration [get]
+func (h *WellKnownHandler) OpenIDConfiguration(c *gin.Context) {
+	c.Header("Cache-Control", jwksMaxAge)
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                h.issuer,
+		"authorization_endpoint":                h.issuer + "/oauth/authorize",
+		"token_endpoint":                        h.issuer + "/oauth/token",
+		"device_authorization_endpoint":         h.issuer + "/oauth/device_authorization",
+		"introspection_endpoint":                h.issuer + "/oauth/introspect",
+		"revocation_endpoint":                   h.issuer + "/oauth/revoke",
+		"registration_endpoint":                 h.issuer + "/oauth/register",
+		"jwks_uri":                              h.issuer + "/.well-known/jwks.json",
+		"userinfo_endpoint":                     h.issuer + "/userinfo",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token", "client_credentials", service.DeviceCodeGrantType, service.TokenExchangeGrantType},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"none", "client_secret_basic", "client_secret_post"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": h.keys.ValidMethods(),
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+		"backchannel_logout_supported":          true,
+		"backchannel_logout_session_supported":  true,
+		"claims_supported":                      []string{"sub", "iss", "aud", "exp", "iat", "sid", "nonce", "email", "email_verified", "preferred_username"},
+	})
+}
+
+// JWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys used to sign access tokens, selected by the kid token header. Includes retired keys until the tokens they signed have expired
+// @Tags Discovery
+// @Produce json
+// @Success 200 {object} lib.JWKSet "Public signing keys"
+// @Router /.well-known/jwks.json [get]
+func (h *WellKnownHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", jwksMaxAge)
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
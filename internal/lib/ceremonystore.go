@@ -0,0 +1,53 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrCeremonyNotFound = errors.New("ceremony not found or expired")
+
+// CeremonyStore keeps short-lived state of multi-step flows (e.g. WebAuthn challenges) between requests.
+type CeremonyStore interface {
+	Save(kind, id string, value interface{}, expiry time.Duration) error
+	// Take loads and deletes the state, so that every ceremony can be completed only once.
+	Take(kind, id string, value interface{}) error
+}
+
+type RedisCeremonyStore struct {
+	client *redis.Client
+}
+
+func NewRedisCeremonyStore(redisURL string) (*RedisCeremonyStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr: redisURL,
+	})
+	_, err := client.Ping(context.Background()).Result()
+	if err != nil {
+		return nil, err
+	}
+	return &RedisCeremonyStore{client: client}, nil
+}
+
+func (s *RedisCeremonyStore) Save(kind, id string, value interface{}, expiry time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(context.Background(), "ceremony:"+kind+":"+id, data, expiry).Err()
+}
+
+func (s *RedisCeremonyStore) Take(kind, id string, value interface{}) error {
+	data, err := s.client.GetDel(context.Background(), "ceremony:"+kind+":"+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return ErrCeremonyNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
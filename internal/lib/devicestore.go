@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+)
+
+var ErrDeviceCodeNotFound = errors.New("device code not found")
+
+// DeviceAuthorization is the state of a pending device authorization (RFC 8628).
+type DeviceAuthorization struct {
+	ClientID  string        `json:"client_id"`
+	Scope     string        `json:"scope"`
+	UserCode  string        `json:"user_code"`
+	Status    string        `json:"status"`
+	UserID    uint          `json:"user_id,omitempty"` // Set once approved
+	Interval  time.Duration `json:"interval"`          // Minimum polling interval, raised on slow_down
+	ExpiresAt time.Time     `json:"expires_at"`
+}
+
+// DeviceCodeStore keeps device authorizations between the device's polling and the user's
+// approval. Device codes are looked up by the poller, user codes by the approving user.
+type DeviceCodeStore interface {
+	Save(deviceCode string, auth *DeviceAuthorization, expiry time.Duration) error
+	Get(deviceCode string) (*DeviceAuthorization, error)
+	FindByUserCode(userCode string) (string, *DeviceAuthorization, error)
+	// Update replaces the state without extending its lifetime.
+	Update(deviceCode string, auth *DeviceAuthorization) error
+	// Throttle reports whether the device may poll now, allowing one poll per interval.
+	Throttle(deviceCode string, interval time.Duration) (bool, error)
+	// Take loads and deletes the state, so that an approved authorization is redeemed only once.
+	Take(deviceCode string) (*DeviceAuthorization, error)
+}
+
+type RedisDeviceCodeStore struct {
+	client *redis.Client
+}
+
+func NewRedisDeviceCodeStore(redisURL string) (*RedisDeviceCodeStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr: redisURL,
+	})
+	_, err := client.Ping(context.Background()).Result()
+	if err != nil {
+		return nil, err
+	}
+	return &RedisDeviceCodeStore{client: client}, nil
+}
+
+func (s *RedisDeviceCodeStore) Save(deviceCode string, auth *DeviceAuthorization, expiry time.Duration) error {
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	ok, err := s.client.SetNX(ctx, "device_user_code:"+auth.UserCode, deviceCode, expiry).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("user code already in use")
+	}
+	return s.client.Set(ctx, "device_code:"+deviceCode, data, expiry).Err()
+}
+
+func (s *RedisDeviceCodeStore) Get(deviceCode string) (*DeviceAuthorization, error) {
+	data, err := s.client.Get(context.Background(), "device_code:"+deviceCode).Bytes()
+	return decodeDeviceAuthorization(data, err)
+}
+
+func (s *RedisDeviceCodeStore) FindByUserCode(userCode string) (string, *DeviceAuthorization, error) {
+	deviceCode, err := s.client.Get(context.Background(), "device_user_code:"+userCode).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil, ErrDeviceCodeNotFound
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	auth, err := s.Get(deviceCode)
+	if err != nil {
+		return "", nil, err
+	}
+	return deviceCode, auth, nil
+}
+
+func (s *RedisDeviceCodeStore) Update(deviceCode string, auth *DeviceAuthorization) error {
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return err
+	}
+	err = s.client.SetArgs(context.Background(), "device_code:"+deviceCode, data, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if errors.Is(err, redis.Nil) {
+		return ErrDeviceCodeNotFound
+	}
+	return err
+}
+
+func (s *RedisDeviceCodeStore) Throttle(deviceCode string, interval time.Duration) (bool, error) {
+	return s.client.SetNX(context.Background(), "device_poll:"+deviceCode, "1", interval).Result()
+}
+
+func (s *RedisDeviceCodeStore) Take(deviceCode string) (*DeviceAuthorization, error) {
+	data, err := s.client.GetDel(context.Background(), "device_code:"+deviceCode).Bytes()
+	auth, err := decodeDeviceAuthorization(data, err)
+	if err != nil {
+		return nil, err
+	}
+	s.client.Del(context.Background(), "device_user_code:"+auth.UserCode)
+	return auth, nil
+}
+
+func decodeDeviceAuthorization(data []byte, err error) (*DeviceAuthorization, error) {
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrDeviceCodeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var auth DeviceAuthorization
+	if err := json.Unmarshal(data, &auth); err != nil {
+		return nil, err
+	}
+	return &auth, nil
+}
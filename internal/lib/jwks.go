@@ -0,0 +1,63 @@
+package lib
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+)
+
+// JWK is the public JSON Web Key (RFC 7517) representation of a signing key.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK encodes the public half of the key. Only public parameters are ever copied.
+func (k *SigningKey) JWK() JWK {
+	jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Method.Alg()}
+	switch pub := k.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64URL(pub.N.Bytes())
+		jwk.E = base64URL(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.KeyType = "EC"
+		jwk.Curve = pub.Curve.Params().Name
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.X = base64URL(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64URL(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64URL(pub)
+	}
+	return jwk
+}
+
+// JWKS returns the public keys of the active and retired keys, so that tokens signed before a
+// rotation keep verifying downstream until they expire.
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ks.Keys() {
+		set.Keys = append(set.Keys, key.JWK())
+	}
+	return set
+}
+
+func base64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
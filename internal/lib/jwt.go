@@ -1,42 +1,268 @@
 package lib
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	AccessTokenTTL  = 60 * time.Minute
+	RefreshTokenTTL = 7 * 24 * time.Hour
+)
+
 type TokenClaims struct {
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	UserID    uint   `json:"user_id"`
+	SessionID string `json:"sid,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Actor     *Actor `json:"act,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Actor is the RFC 8693 act claim: the party acting on behalf of the subject. Nested actors
+// record earlier delegations, most recent first.
+type Actor struct {
+	Subject string `json:"sub"`
+	Actor   *Actor `json:"act,omitempty"`
+}
+
+// Grant describes what an access token is issued for: the session it belongs to and, for
+// OAuth clients, the client and the scopes it was granted. First-party logins leave ClientID
+// and Scope empty.
+type Grant struct {
+	SessionID string
+	ClientID  string
+	Scope     string
+}
+
+// RefreshClaims identifies a single refresh token (jti) and the rotation family it belongs to.
+type RefreshClaims struct {
 	Username string `json:"username"`
-	Role     string `json:"role"`
 	UserID   uint   `json:"user_id"`
+	FamilyID string `json:"fid"`
 	jwt.RegisteredClaims
 }
 
-func GenerateAccessToken(userID uint, username, role string, secret []byte) (string, error) {
+// GenerateAccessToken signs an access token with the key set's active key, so that other
+// services can verify it with the public key alone.
+func GenerateAccessToken(userID uint, username, role string, grant Grant, issuer string, keys *KeySet) (string, error) {
+	claims := TokenClaims{
+		Username:  username,
+		Role:      role,
+		UserID:    userID,
+		SessionID: grant.SessionID,
+		ClientID:  grant.ClientID,
+		Scope:     grant.Scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   Subject(userID),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    issuer,
+			Audience:  []string{"api"},
+		},
+	}
+	return keys.Sign(claims)
+}
+
+// GenerateClientToken signs an access token for an OAuth client acting on its own behalf
+// (client credentials grant). The subject is the client and there is no user, role or session:
+// what the token may do is defined by the granted scopes only.
+func GenerateClientToken(clientID, scope, issuer string, keys *KeySet) (string, error) {
+	claims := TokenClaims{
+		ClientID: clientID,
+		Scope:    scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   clientID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    issuer,
+			Audience:  []string{"api"},
+		},
+	}
+	return keys.Sign(claims)
+}
+
+// GenerateDelegatedToken signs a token that lets actorClientID call audience on behalf of the
+// subject token's user (token exchange). The user claims and session are kept so that revoking
+// the session revokes the delegated token too, and it never outlives the subject token.
+func GenerateDelegatedToken(subject *TokenClaims, actorClientID, scope, audience, issuer string, keys *KeySet) (string, time.Time, error) {
+	expiresAt := time.Now().Add(AccessTokenTTL)
+	if subject.ExpiresAt != nil && subject.ExpiresAt.Time.Before(expiresAt) {
+		expiresAt = subject.ExpiresAt.Time
+	}
 	claims := TokenClaims{
+		Username:  subject.Username,
+		Role:      subject.Role,
+		UserID:    subject.UserID,
+		SessionID: subject.SessionID,
+		ClientID:  actorClientID,
+		Scope:     scope,
+		Actor:     &Actor{Subject: actorClientID, Actor: subject.Actor},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject.Subject,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    issuer,
+			Audience:  []string{audience},
+		},
+	}
+	token, err := keys.Sign(claims)
+	return token, expiresAt, err
+}
+
+// IsClientToken reports whether the token was issued to a client without a user.
+func (c *TokenClaims) IsClientToken() bool {
+	return c.UserID == 0 && c.ClientID != ""
+}
+
+// ParseAccessToken verifies an access token for this service's API (aud=api) against the key
+// selected by its kid header.
+func ParseAccessToken(tokenStr, issuer string, keys *KeySet) (*TokenClaims, error) {
+	return parseAccessToken(tokenStr, issuer, keys, jwt.WithAudience("api"))
+}
+
+// ParseIssuedAccessToken verifies any access token this service issued, including exchanged
+// tokens addressed to another audience. It is meant for introspection and revocation; the API
+// itself must only accept tokens from ParseAccessToken.
+func ParseIssuedAccessToken(tokenStr, issuer string, keys *KeySet) (*TokenClaims, error) {
+	claims, err := parseAccessToken(tokenStr, issuer, keys)
+	if err != nil {
+		return nil, err
+	}
+	// ID tokens are signed with the same keys; exchanged tokens are told apart by their act claim
+	if claims.Actor == nil && !slices.Contains(claims.Audience, "api") {
+		return nil, errors.New("invalid or expired token")
+	}
+	return claims, nil
+}
+
+func parseAccessToken(tokenStr, issuer string, keys *KeySet, opts ...jwt.ParserOption) (*TokenClaims, error) {
+	opts = append(opts, jwt.WithValidMethods(keys.ValidMethods()), jwt.WithIssuer(issuer))
+	token, err := jwt.ParseWithClaims(tokenStr, &TokenClaims{}, keys.Keyfunc, opts...)
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid or expired token")
+	}
+
+	claims, ok := token.Claims.(*TokenClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
+}
+
+func GenerateRefreshToken(userID uint, username, tokenID, familyID, issuer string, secret []byte) (string, error) {
+	claims := RefreshClaims{
 		Username: username,
-		Role:     role,
 		UserID:   userID,
+		FamilyID: familyID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(60 * time.Minute)),
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(RefreshTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "my-gin-app",
-			Audience:  []string{"api"},
+			Issuer:    issuer,
+			Audience:  []string{"refresh"},
 		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(secret)
 }
 
-func GenerateRefreshToken(userID uint, username string, secret []byte) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id":  userID,
-		"username": username,
-		"exp":      time.Now().Add(7 * 24 * time.Hour).Unix(),
-		"iss":      "my-gin-app",
-		"aud":      "refresh",
+func ParseRefreshToken(tokenStr, issuer string, secret []byte) (*RefreshClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &RefreshClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return secret, nil
+	}, jwt.WithAudience("refresh"), jwt.WithIssuer(issuer))
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid refresh token")
+	}
+
+	claims, ok := token.Claims.(*RefreshClaims)
+	if !ok || claims.ID == "" || claims.FamilyID == "" || claims.UserID == 0 {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
+}
+
+// PurposeClaims back short-lived, single-purpose tokens such as MFA challenges. The purpose is
+// carried in the audience so that a token minted for one flow cannot be replayed in another.
+type PurposeClaims struct {
+	UserID uint              `json:"user_id"`
+	Data   map[string]string `json:"data,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func GeneratePurposeToken(purpose string, userID uint, ttl time.Duration, data map[string]string, issuer string, secret []byte) (string, error) {
+	tokenID, err := NewTokenID()
+	if err != nil {
+		return "", err
+	}
+	claims := PurposeClaims{
+		UserID: userID,
+		Data:   data,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    issuer,
+			Audience:  []string{purpose},
+		},
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(secret)
 }
+
+func ParsePurposeToken(tokenStr, purpose, issuer string, secret []byte) (*PurposeClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &PurposeClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return secret, nil
+	}, jwt.WithAudience(purpose), jwt.WithIssuer(issuer))
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid or expired token")
+	}
+
+	claims, ok := token.Claims.(*PurposeClaims)
+	if !ok || claims.ID == "" || claims.UserID == 0 {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
+}
+
+// NewTokenID returns a random hex identifier suitable for jti and family IDs.
+func NewTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NewOpaqueToken returns a random secret token for links sent by email.
+func NewOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// PersonalAccessTokenPrefix starts every personal access token, which tells them apart from
+// JWTs in the Authorization header and makes leaked ones easy to scan for.
+const PersonalAccessTokenPrefix = "pat_"
+
+// HashToken returns the hex SHA-256 digest under which opaque tokens are stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,242 @@
+package lib
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is an asymmetric key identified by its kid. The private half never leaves this package.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+// Public returns the public half used for verification and publication.
+func (k *SigningKey) Public() crypto.PublicKey {
+	return k.private.Public()
+}
+
+// NewSigningKey wraps an RSA, ECDSA (P-256/P-384) or Ed25519 private key and derives its JWT algorithm.
+func NewSigningKey(id string, private crypto.Signer) (*SigningKey, error) {
+	if id == "" {
+		return nil, errors.New("key ID is required")
+	}
+	var method jwt.SigningMethod
+	switch key := private.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("key %s: RSA keys must be at least 2048 bits", id)
+		}
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		switch key.Curve {
+		case elliptic.P256():
+			method = jwt.SigningMethodES256
+		case elliptic.P384():
+			method = jwt.SigningMethodES384
+		default:
+			return nil, fmt.Errorf("key %s: unsupported elliptic curve", id)
+		}
+	case ed25519.PrivateKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %T", id, private)
+	}
+	return &SigningKey{ID: id, Method: method, private: private}, nil
+}
+
+// KeySet holds the active signing key plus previously active keys that are kept for
+// verification until every token they signed has expired.
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+func NewKeySet(active *SigningKey, retired ...*SigningKey) *KeySet {
+	ks := &KeySet{active: active, keys: map[string]*SigningKey{active.ID: active}}
+	for _, key := range retired {
+		ks.keys[key.ID] = key
+	}
+	return ks
+}
+
+// LoadKeySet reads every *.pem private key in dir, using the file name (without extension)
+// as kid. The key named activeID signs new tokens; the others only verify.
+func LoadKeySet(dir, activeID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	var active *SigningKey
+	var retired []*SigningKey
+	for _, path := range paths {
+		id := strings.TrimSuffix(filepath.Base(path), ".pem")
+		private, err := readPrivateKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		key, err := NewSigningKey(id, private)
+		if err != nil {
+			return nil, err
+		}
+		if id == activeID {
+			active = key
+		} else {
+			retired = append(retired, key)
+		}
+	}
+	if active == nil {
+		return nil, fmt.Errorf("active key %q not found in %s", activeID, dir)
+	}
+	return NewKeySet(active, retired...), nil
+}
+
+// NewEphemeralKeySet generates a throwaway Ed25519 key. Tokens do not survive a restart,
+// so this is only meant for local development.
+func NewEphemeralKeySet() (*KeySet, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id, err := NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+	key, err := NewSigningKey("dev-"+id[:8], private)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySet(key), nil
+}
+
+// Sign signs claims with the active key and sets the kid header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	return ks.SignWithType(claims, "JWT")
+}
+
+// SignWithType is Sign with an explicit typ header, for tokens that must not be mistaken for
+// access or ID tokens.
+func (ks *KeySet) SignWithType(claims jwt.Claims, typ string) (string, error) {
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+	token.Header["typ"] = typ
+	return token.SignedString(ks.active.private)
+}
+
+// Keyfunc selects the verification key by the token's kid header and rejects algorithm mismatches.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.Public(), nil
+}
+
+// ValidMethods lists the algorithms of all keys, for jwt.WithValidMethods.
+func (ks *KeySet) ValidMethods() []string {
+	seen := map[string]bool{}
+	var methods []string
+	for _, key := range ks.keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Keys returns every key, active first, then retired keys ordered by ID.
+func (ks *KeySet) Keys() []*SigningKey {
+	keys := []*SigningKey{ks.active}
+	var retired []*SigningKey
+	for id, key := range ks.keys {
+		if id != ks.active.ID {
+			retired = append(retired, key)
+		}
+	}
+	sort.Slice(retired, func(i, j int) bool { return retired[i].ID < retired[j].ID })
+	return append(keys, retired...)
+}
+
+// LoadRSAKeyPair reads a PEM certificate and its RSA private key, as used by SAML.
+func LoadRSAKeyPair(certFile, keyFile string) (*rsa.PrivateKey, *x509.Certificate, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: an RSA key is required", keyFile)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, cert, nil
+}
+
+// LoadCertPool reads a PEM bundle of CA certificates.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: no certificates found", path)
+	}
+	return pool, nil
+}
+
+func readPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("key cannot sign")
+	}
+	return signer, nil
+}
@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ProfileClaims are the standard OpenID Connect claims describing the end user. They are
+// shared by ID tokens and the /userinfo response.
+type ProfileClaims struct {
+	Email             string `json:"email,omitempty"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+}
+
+// UserInfo is the /userinfo response body.
+type UserInfo struct {
+	Subject string `json:"sub"`
+	ProfileClaims
+}
+
+// IDTokenClaims identify the authenticated user to the client named in the audience.
+type IDTokenClaims struct {
+	ProfileClaims
+	SessionID string `json:"sid,omitempty"`
+	Nonce     string `json:"nonce,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// BackchannelLogoutEvent is the events member identifying a logout token.
+const BackchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// LogoutTokenTTL bounds how long a logout token is accepted by the receiving client.
+const LogoutTokenTTL = 2 * time.Minute
+
+// LogoutTokenClaims tell a client that the user's session sid has ended (OIDC Back-Channel Logout).
+type LogoutTokenClaims struct {
+	SessionID string                            `json:"sid"`
+	Events    map[string]map[string]interface{} `json:"events"`
+	jwt.RegisteredClaims
+}
+
+// Subject returns the OIDC subject identifier of a user.
+func Subject(userID uint) string {
+	return strconv.FormatUint(uint64(userID), 10)
+}
+
+// GenerateIDToken signs an ID token for the given client with the key set's active key. The
+// nonce from the authorization request, if any, is echoed back for replay protection.
+func GenerateIDToken(userID uint, profile ProfileClaims, sessionID, audience, nonce, issuer string, keys *KeySet) (string, error) {
+	claims := IDTokenClaims{
+		ProfileClaims: profile,
+		SessionID:     sessionID,
+		Nonce:         nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   Subject(userID),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    issuer,
+			Audience:  []string{audience},
+		},
+	}
+	return keys.Sign(claims)
+}
+
+// GenerateLogoutToken signs a back-channel logout token for the client audience. It has the
+// logout+jwt type and, unlike an ID token, never carries a nonce.
+func GenerateLogoutToken(userID uint, sessionID, audience, issuer string, keys *KeySet) (string, error) {
+	tokenID, err := NewTokenID()
+	if err != nil {
+		return "", err
+	}
+	claims := LogoutTokenClaims{
+		SessionID: sessionID,
+		Events:    map[string]map[string]interface{}{BackchannelLogoutEvent: {}},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			Subject:   Subject(userID),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(LogoutTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    issuer,
+			Audience:  []string{audience},
+		},
+	}
+	return keys.SignWithType(claims, "logout+jwt")
+}
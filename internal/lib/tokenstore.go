@@ -10,6 +10,10 @@ import (
 type TokenStore interface {
 	Blacklist(token string, expiry time.Duration) error
 	IsBlacklisted(token string) (bool, error)
+	RevokeSession(sessionID string, expiry time.Duration) error
+	IsSessionRevoked(sessionID string) (bool, error)
+	// Consume atomically marks a single-use token ID as used. It returns false if it was already used.
+	Consume(tokenID string, expiry time.Duration) (bool, error)
 }
 
 // type InMemoryTokenStore struct {
@@ -67,3 +71,18 @@ func (s *RedisTokenStore) IsBlacklisted(token string) (bool, error) {
 	exists, err := s.client.Exists(context.Background(), "blacklist:"+token).Result()
 	return exists == 1, err
 }
+
+// RevokeSession marks a session as revoked so that access tokens carrying its sid are rejected
+// until they would have expired anyway.
+func (s *RedisTokenStore) RevokeSession(sessionID string, expiry time.Duration) error {
+	return s.client.Set(context.Background(), "revoked_session:"+sessionID, "1", expiry).Err()
+}
+
+func (s *RedisTokenStore) IsSessionRevoked(sessionID string) (bool, error) {
+	exists, err := s.client.Exists(context.Background(), "revoked_session:"+sessionID).Result()
+	return exists == 1, err
+}
+
+func (s *RedisTokenStore) Consume(tokenID string, expiry time.Duration) (bool, error) {
+	return s.client.SetNX(context.Background(), "consumed:"+tokenID, "1", expiry).Result()
+}
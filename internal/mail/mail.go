@@ -0,0 +1,122 @@
+package mail
+
+import (
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers emails. Implementations are selected with MAIL_DRIVER.
+type Sender interface {
+	Send(msg Message) error
+}
+
+// NewSender returns the sender for the given driver: "smtp", "file" or "log" (default).
+func NewSender(driver, from, smtpAddr, smtpUsername, smtpPassword, dir string, log *logrus.Logger) (Sender, error) {
+	switch driver {
+	case "smtp":
+		if smtpAddr == "" {
+			return nil, fmt.Errorf("SMTP_ADDR is required for the smtp mail driver")
+		}
+		return NewSMTPSender(smtpAddr, from, smtpUsername, smtpPassword), nil
+	case "file":
+		return NewFileSender(dir, from)
+	case "", "log":
+		return NewLogSender(log), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", driver)
+	}
+}
+
+// LogSender writes emails to the application log instead of delivering them. Useful in development.
+type LogSender struct {
+	log *logrus.Logger
+}
+
+func NewLogSender(log *logrus.Logger) *LogSender {
+	return &LogSender{log: log}
+}
+
+func (s *LogSender) Send(msg Message) error {
+	s.log.WithFields(logrus.Fields{
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"body":    msg.Body,
+	}).Info("Email (log driver)")
+	return nil
+}
+
+// FileSender writes each email as an .eml file into a directory, so flows can be completed offline.
+type FileSender struct {
+	dir  string
+	from string
+}
+
+func NewFileSender(dir, from string) (*FileSender, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &FileSender{dir: dir, from: from}, nil
+}
+
+func (s *FileSender) Send(msg Message) error {
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitizeFilename(msg.To))
+	return os.WriteFile(filepath.Join(s.dir, name), buildMessage(s.from, msg), 0o600)
+}
+
+// SMTPSender delivers emails through an SMTP relay using PLAIN auth when credentials are set.
+type SMTPSender struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPSender(addr, from, username, password string) *SMTPSender {
+	var auth smtp.Auth
+	if username != "" {
+		host := addr
+		if i := strings.LastIndex(addr, ":"); i > 0 {
+			host = addr[:i]
+		}
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPSender{addr: addr, from: from, auth: auth}
+}
+
+func (s *SMTPSender) Send(msg Message) error {
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, buildMessage(s.from, msg))
+}
+
+func buildMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	return []byte(b.String())
+}
+
+func sanitizeFilename(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == '\r' || r == '\n' {
+			return '_'
+		}
+		return r
+	}, value)
+}
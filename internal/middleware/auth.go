@@ -1,18 +1,24 @@
 package middleware
 
 import (
-	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/shahariaz/gin-auth-service/internal/errs"
 	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/model"
 	"github.com/sirupsen/logrus"
 )
 
-func JWTAuthMiddleware(secret []byte, tokenStore lib.TokenStore, log *logrus.Logger) gin.HandlerFunc {
+// PersonalAccessTokens verifies personal access tokens (service.PersonalAccessTokenService).
+type PersonalAccessTokens interface {
+	Verify(token, ipAddress string) (*model.PersonalAccessToken, *model.User, error)
+}
+
+// JWTAuthMiddleware authenticates access tokens, and personal access tokens (recognised by
+// their prefix) with pats.
+func JWTAuthMiddleware(keys *lib.KeySet, issuer string, tokenStore lib.TokenStore, pats PersonalAccessTokens, log *logrus.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		auth := c.GetHeader("Authorization")
 		if auth == "" || !strings.HasPrefix(auth, "Bearer ") {
@@ -23,6 +29,10 @@ func JWTAuthMiddleware(secret []byte, tokenStore lib.TokenStore, log *logrus.Log
 		}
 
 		tokenStr := auth[7:]
+		if strings.HasPrefix(tokenStr, lib.PersonalAccessTokenPrefix) {
+			authenticatePersonalAccessToken(c, pats, tokenStr, log)
+			return
+		}
 		isBlacklisted, err := tokenStore.IsBlacklisted(tokenStr)
 		if err != nil {
 			log.WithError(err).Error("Token store error")
@@ -37,35 +47,146 @@ func JWTAuthMiddleware(secret []byte, tokenStore lib.TokenStore, log *logrus.Log
 			return
 		}
 
-		token, err := jwt.ParseWithClaims(tokenStr, &lib.TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("unexpected signing method")
-			}
-			return secret, nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := lib.ParseAccessToken(tokenStr, issuer, keys)
+		if err != nil {
 			log.WithError(err).Warn("Invalid token")
 			errs.HandleError(c, errs.NewAPIError(http.StatusUnauthorized, "Invalid or expired token", err), log)
 			c.Abort()
 			return
 		}
 
-		claims, ok := token.Claims.(*lib.TokenClaims)
-		if !ok || claims.Username == "" || claims.Role == "" {
+		if claims.IsClientToken() {
+			// Client credentials token: the client is the subject and its scopes are its permissions
+			c.Set("client_id", claims.ClientID)
+			c.Set("scopes", strings.Fields(claims.Scope))
+			c.Next()
+			return
+		}
+
+		if claims.Username == "" || claims.Role == "" {
 			log.Warn("Invalid claims")
 			errs.HandleError(c, errs.NewAPIError(http.StatusUnauthorized, "Invalid token claims", nil), log)
 			c.Abort()
 			return
 		}
 
+		if claims.SessionID != "" {
+			revoked, err := tokenStore.IsSessionRevoked(claims.SessionID)
+			if err != nil {
+				log.WithError(err).Error("Token store error")
+				errs.HandleError(c, errs.NewAPIError(http.StatusInternalServerError, "Internal server error", err), log)
+				c.Abort()
+				return
+			}
+			if revoked {
+				log.WithField("user_id", claims.UserID).Warn("Token from revoked session used")
+				errs.HandleError(c, errs.NewAPIError(http.StatusUnauthorized, "Session has been revoked", nil), log)
+				c.Abort()
+				return
+			}
+		}
+
 		c.Set("user", claims.Username)
 		c.Set("role", claims.Role)
 		c.Set("user_id", claims.UserID)
+		c.Set("session_id", claims.SessionID)
+		if claims.ClientID != "" {
+			c.Set("client_id", claims.ClientID)
+			c.Set("scopes", strings.Fields(claims.Scope))
+		}
+		if claims.Actor != nil {
+			c.Set("actor", claims.Actor.Subject) // Delegated by token exchange
+		}
 		c.Next()
 	}
 }
 
+// authenticatePersonalAccessToken authenticates the request as the token's user. Tokens with
+// scopes need read for safe methods and write for the others; admin is checked by
+// RequireRoleOrScope.
+func authenticatePersonalAccessToken(c *gin.Context, pats PersonalAccessTokens, token string, log *logrus.Logger) {
+	record, user, err := pats.Verify(token, c.ClientIP())
+	if err != nil {
+		log.WithError(err).Warn("Invalid personal access token")
+		errs.HandleError(c, errs.NewAPIError(http.StatusUnauthorized, "Invalid or expired token", err), log)
+		c.Abort()
+		return
+	}
+
+	if record.Scope != "" {
+		scopes := strings.Fields(record.Scope)
+		safe := c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions
+		if !hasScope(scopes, "write") && !(safe && hasScope(scopes, "read")) {
+			log.WithFields(logrus.Fields{"user_id": user.ID, "token_id": record.ID}).Warn("Personal access token scope denied")
+			errs.HandleError(c, errs.NewAPIError(http.StatusForbidden, "Forbidden: token lacks the read or write scope", nil), log)
+			c.Abort()
+			return
+		}
+		c.Set("scopes", scopes)
+	}
+
+	c.Set("user", user.Username)
+	c.Set("role", user.Role.Name)
+	c.Set("user_id", user.ID)
+	c.Set("personal_access_token_id", record.ID)
+	c.Next()
+}
+
+// RequireUser rejects tokens that do not belong to a user, i.e. client credentials tokens.
+func RequireUser(log *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("user_id") == 0 {
+			log.WithField("client_id", c.GetString("client_id")).Warn("Client token used on a user route")
+			errs.HandleError(c, errs.NewAPIError(http.StatusForbidden, "Forbidden: user token required", nil), log)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireFirstParty rejects user tokens issued to OAuth clients. Their scopes (openid, email,
+// ...) only cover the OAuth endpoints such as userinfo, not the account management routes of
+// the first-party frontend.
+func RequireFirstParty(log *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if clientID, ok := c.Get("client_id"); ok {
+			log.WithField("client_id", clientID).Warn("OAuth client token used on a first-party route")
+			errs.HandleError(c, errs.NewAPIError(http.StatusForbidden, "Forbidden: first-party token required", nil), log)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRoleOrScope authorizes users by role and clients by scope. Client credentials tokens
+// need the scope; user tokens need the role and, when issued to an OAuth client or restricted
+// to scopes (personal access tokens), the scope too.
+func RequireRoleOrScope(role, scope string, log *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		isUser := c.GetUint("user_id") != 0
+		_, scoped := c.Get("scopes")
+		allowed := (!isUser || c.GetString("role") == role) && (!scoped || hasScope(c.GetStringSlice("scopes"), scope))
+		if !allowed {
+			log.WithFields(logrus.Fields{"required_role": role, "required_scope": scope}).Warn("Access denied")
+			errs.HandleError(c, errs.NewAPIError(http.StatusForbidden, "Forbidden: "+role+" role or "+scope+" scope required", nil), log)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
 func RequireRole(role string, log *logrus.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userRole, exists := c.Get("role")
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+)
+
+const testIssuer = "https://auth.example.com"
+
+type testPersonalAccessTokens map[string]*model.PersonalAccessToken
+
+func (p testPersonalAccessTokens) Verify(token, ipAddress string) (*model.PersonalAccessToken, *model.User, error) {
+	record, ok := p[token]
+	if !ok {
+		return nil, nil, io.EOF
+	}
+	return record, &model.User{ID: 7, Username: "jane", Role: model.Role{Name: "admin"}}, nil
+}
+
+func newTestRouter(t *testing.T, pats PersonalAccessTokens) (*gin.Engine, *lib.KeySet) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	keys, err := lib.NewEphemeralKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redis := miniredis.RunT(t)
+	tokenStore, err := lib.NewRedisTokenStore(redis.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := func(c *gin.Context) { c.String(http.StatusOK, "ok") }
+	auth := JWTAuthMiddleware(keys, testIssuer, tokenStore, pats, log)
+	r := gin.New()
+	r.GET("/userinfo", auth, RequireUser(log), ok)
+	api := r.Group("/api")
+	api.Use(auth, RequireUser(log), RequireFirstParty(log))
+	api.GET("/profile", ok)
+	api.POST("/profile", ok)
+	admin := r.Group("/api/admin")
+	admin.Use(auth, RequireRoleOrScope("admin", "admin", log))
+	admin.GET("/users", ok)
+	return r, keys
+}
+
+func request(r *gin.Engine, method, path, token string) int {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestOAuthClientUserTokenIsLimitedToUserinfo(t *testing.T) {
+	r, keys := newTestRouter(t, testPersonalAccessTokens{})
+	firstParty, err := lib.GenerateAccessToken(7, "jane", "user", lib.Grant{SessionID: "s1"}, testIssuer, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientToken, err := lib.GenerateAccessToken(7, "jane", "user", lib.Grant{SessionID: "s2", ClientID: "app", Scope: "openid"}, testIssuer, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := request(r, http.MethodGet, "/api/profile", firstParty); code != http.StatusOK {
+		t.Errorf("first-party token on /api/profile: got %d, want 200", code)
+	}
+	if code := request(r, http.MethodGet, "/api/profile", clientToken); code != http.StatusForbidden {
+		t.Errorf("openid-only client token on /api/profile: got %d, want 403", code)
+	}
+	if code := request(r, http.MethodGet, "/userinfo", clientToken); code != http.StatusOK {
+		t.Errorf("openid-only client token on /userinfo: got %d, want 200", code)
+	}
+}
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	r, _ := newTestRouter(t, testPersonalAccessTokens{
+		"pat_full":       {ID: 1},
+		"pat_read":       {ID: 2, Scope: "read"},
+		"pat_write":      {ID: 3, Scope: "write"},
+		"pat_read_admin": {ID: 4, Scope: "read admin"},
+	})
+	tests := []struct {
+		method, path, token string
+		want                int
+	}{
+		{http.MethodPost, "/api/profile", "pat_full", http.StatusOK},
+		{http.MethodGet, "/api/admin/users", "pat_full", http.StatusOK},
+		{http.MethodGet, "/api/profile", "pat_read", http.StatusOK},
+		{http.MethodPost, "/api/profile", "pat_read", http.StatusForbidden},
+		{http.MethodGet, "/api/admin/users", "pat_read", http.StatusForbidden},
+		{http.MethodPost, "/api/profile", "pat_write", http.StatusOK},
+		{http.MethodGet, "/api/admin/users", "pat_read_admin", http.StatusOK},
+		{http.MethodGet, "/api/profile", "pat_unknown", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if code := request(r, tt.method, tt.path, tt.token); code != tt.want {
+			t.Errorf("%s %s with %s: got %d, want %d", tt.method, tt.path, tt.token, code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+)
+
+// OAuthGrant records the scopes a user has consented to for an OAuth client
+// @Description Scopes granted by the user to an application
+type OAuthGrant struct {
+	ID         uint      `gorm:"primaryKey" json:"-"`
+	UserID     uint      `gorm:"uniqueIndex:idx_oauth_grant_user_client;not null" json:"-"`
+	ClientID   string    `gorm:"uniqueIndex:idx_oauth_grant_user_client;size:64;not null" json:"client_id" example:"c2f7a9e4b1d3f5a7c9e1b3d5f7a9c1e3"`
+	Scope      string    `gorm:"size:512" json:"scope" example:"openid email profile"` // Space separated, grows as the user approves more scopes
+	CreatedAt  time.Time `json:"created_at" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt  time.Time `json:"updated_at" example:"2023-01-02T00:00:00Z"`
+	ClientName string    `gorm:"-" json:"client_name" example:"Mobile app"`
+}
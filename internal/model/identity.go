@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+)
+
+// Identity links a user to an account at an external OpenID Connect or SAML provider. A user can have
+// any number of identities next to a password and passkeys.
+// @Description Linked external identity
+type Identity struct {
+	ID          uint       `gorm:"primaryKey" json:"id" example:"1"`
+	UserID      uint       `gorm:"index;not null" json:"-"`
+	Provider    string     `gorm:"uniqueIndex:idx_identity_provider_subject;size:50;not null" json:"provider" example:"google"`
+	Subject     string     `gorm:"uniqueIndex:idx_identity_provider_subject;size:255;not null" json:"subject" example:"110169484474386276334"` // sub claim or NameID at the provider
+	Email       string     `gorm:"size:255" json:"email,omitempty" example:"john@example.com"`
+	LinkedAt    time.Time  `gorm:"autoCreateTime" json:"linked_at" example:"2023-01-01T00:00:00Z"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty" example:"2023-01-02T00:00:00Z"`
+}
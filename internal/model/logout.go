@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	LogoutDeliveryPending   = "pending"
+	LogoutDeliveryDelivered = "delivered"
+	LogoutDeliveryFailed    = "failed" // Gave up after the last retry
+)
+
+// LogoutDelivery tracks a back-channel logout notification sent to an OAuth client
+// @Description Back-channel logout delivery status
+type LogoutDelivery struct {
+	ID            uint       `gorm:"primaryKey" json:"id" example:"1"`
+	ClientID      string     `gorm:"index;size:64;not null" json:"client_id" example:"c2f7a9e4b1d3f5a7c9e1b3d5f7a9c1e3"`
+	UserID        uint       `gorm:"not null" json:"user_id" example:"1"`
+	SessionID     string     `gorm:"size:64;not null" json:"-"` // sid of the ended session
+	URI           string     `gorm:"size:512;not null" json:"uri" example:"https://app.example.com/backchannel-logout"`
+	Status        string     `gorm:"size:20;not null;index:idx_logout_delivery_due" json:"status" example:"delivered"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts" example:"1"`
+	LastError     string     `gorm:"size:512" json:"last_error,omitempty" example:"unexpected status 503"`
+	NextAttemptAt time.Time  `gorm:"index:idx_logout_delivery_due" json:"next_attempt_at" example:"2023-01-01T00:00:30Z"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty" example:"2023-01-01T00:00:01Z"`
+	CreatedAt     time.Time  `json:"created_at" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt     time.Time  `json:"updated_at" example:"2023-01-01T00:00:01Z"`
+}
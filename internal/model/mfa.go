@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+)
+
+// TOTPFactor represents a user's RFC 6238 authenticator app enrollment
+// @Description TOTP second factor enrollment
+type TOTPFactor struct {
+	ID           uint       `gorm:"primaryKey" json:"id" example:"1"`
+	UserID       uint       `gorm:"uniqueIndex;not null" json:"user_id" example:"1"`
+	Secret       string     `gorm:"size:64;not null" json:"-"`
+	ConfirmedAt  *time.Time `json:"confirmed_at,omitempty" example:"2023-01-01T00:00:00Z"` // Nil until the first code is verified
+	LastUsedStep int64      `json:"-"`                                                     // Time step of the last accepted code, prevents replay
+	CreatedAt    time.Time  `json:"created_at" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt    time.Time  `json:"updated_at" example:"2023-01-01T00:00:00Z"`
+}
+
+// MFACodeRequest represents a request carrying a TOTP code
+// @Description TOTP code payload
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric" example:"123456"`
+}
+
+// MFALoginRequest represents the second step of an MFA login
+// @Description MFA login challenge response payload
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	Code     string `json:"code" binding:"required,len=6,numeric" example:"123456"`
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	OAuthClientPublic       = "public"       // SPAs and mobile apps, cannot keep a secret
+	OAuthClientConfidential = "confidential" // Server-side apps authenticating with a client secret
+)
+
+const (
+	OAuthClientPending  = "pending"  // Self-registered, waiting for admin approval
+	OAuthClientActive   = "active"   // Allowed to use the OAuth endpoints
+	OAuthClientDisabled = "disabled" // Blocked by an admin
+)
+
+// OAuthClient represents an application allowed to obtain tokens through the OAuth 2.0 endpoints
+// @Description Registered OAuth client
+type OAuthClient struct {
+	ID               uint      `gorm:"primaryKey" json:"id" example:"1"`
+	ClientID         string    `gorm:"uniqueIndex;size:64;not null" json:"client_id" example:"c2f7a9e4b1d3f5a7c9e1b3d5f7a9c1e3"`
+	SecretHash       string    `gorm:"size:64" json:"-"` // SHA-256 of the client secret, empty for public clients
+	Name             string    `gorm:"size:100;not null" json:"name" example:"Mobile app"`
+	Type             string    `gorm:"size:20;not null" json:"type" example:"public"`
+	RedirectURIs     string    `gorm:"type:text" json:"redirect_uris" example:"https://app.example.com/callback"` // Space separated, matched exactly
+	AllowedScopes    string    `gorm:"size:512" json:"allowed_scopes" example:"openid email profile"`             // Space separated
+	GrantTypes       string    `gorm:"size:255;not null;default:'authorization_code refresh_token'" json:"grant_types" example:"authorization_code refresh_token"`
+	AllowedAudiences string    `gorm:"size:512" json:"allowed_audiences,omitempty" example:"billing-api"` // Space separated, token exchange targets
+	LogoutURI        string    `gorm:"size:512" json:"backchannel_logout_uri,omitempty" example:"https://app.example.com/backchannel-logout"`
+	Status           string    `gorm:"size:20;not null;default:'active';index" json:"status" example:"active"`
+	RegistrationHash string    `gorm:"size:64" json:"-"` // SHA-256 of the registration access token, empty for clients created by admins
+	SelfRegistered   bool      `gorm:"not null;default:false" json:"self_registered" example:"false"`
+	CreatedAt        time.Time `json:"created_at" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt        time.Time `json:"updated_at" example:"2023-01-01T00:00:00Z"`
+}
+
+// HasRedirectURI reports whether uri is registered for the client. Matching is exact, without
+// any normalisation.
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	for _, registered := range strings.Fields(c.RedirectURIs) {
+		if registered == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsGrant reports whether the client may use the given grant type at the token endpoint.
+func (c *OAuthClient) AllowsGrant(grantType string) bool {
+	for _, allowed := range strings.Fields(c.GrantTypes) {
+		if allowed == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAudience reports whether the client may exchange tokens for the given audience.
+func (c *OAuthClient) AllowsAudience(audience string) bool {
+	for _, allowed := range strings.Fields(c.AllowedAudiences) {
+		if allowed == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports whether the client has been approved and not disabled.
+func (c *OAuthClient) IsActive() bool {
+	return c.Status == OAuthClientActive
+}
+
+// IsConfidential reports whether the client must authenticate with its secret.
+func (c *OAuthClient) IsConfidential() bool {
+	return c.Type == OAuthClientConfidential
+}
+
+// CreateOAuthClientRequest represents an OAuth client registration by an admin
+// @Description OAuth client registration payload
+type CreateOAuthClientRequest struct {
+	Name             string   `json:"name" binding:"required,max=100" example:"Mobile app"`
+	Type             string   `json:"type" binding:"required,oneof=public confidential" example:"public"`
+	RedirectURIs     []string `json:"redirect_uris" binding:"omitempty,dive,url" example:"https://app.example.com/callback"` // Required for the authorization_code grant
+	AllowedScopes    []string `json:"allowed_scopes" binding:"required,min=1" example:"openid,email,profile"`
+	GrantTypes       []string `json:"grant_types" binding:"omitempty,dive,oneof=authorization_code refresh_token client_credentials urn:ietf:params:oauth:grant-type:device_code urn:ietf:params:oauth:grant-type:token-exchange" example:"authorization_code,refresh_token"`
+	AllowedAudiences []string `json:"allowed_audiences" example:"billing-api"` // Required for token exchange
+	LogoutURI        string   `json:"backchannel_logout_uri" binding:"omitempty,url" example:"https://app.example.com/backchannel-logout"`
+}
+
+// OAuthAuthorizeRequest represents the user's approval of an authorization request, forwarded
+// by the login UI with the parameters it received at /oauth/authorize
+// @Description OAuth authorization request parameters
+type OAuthAuthorizeRequest struct {
+	ResponseType        string `json:"response_type" example:"code"`
+	ClientID            string `json:"client_id" binding:"required" example:"c2f7a9e4b1d3f5a7c9e1b3d5f7a9c1e3"`
+	RedirectURI         string `json:"redirect_uri" binding:"required" example:"https://app.example.com/callback"`
+	Scope               string `json:"scope" example:"openid email"`
+	State               string `json:"state" example:"af0ifjsldkj"`
+	Nonce               string `json:"nonce" example:"n-0S6_WzA2Mj"`
+	CodeChallenge       string `json:"code_challenge" example:"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"`
+	CodeChallengeMethod string `json:"code_challenge_method" example:"S256"`
+	Approve             *bool  `json:"approve,omitempty" example:"true"` // Consent decision, omit to rely on a prior grant
+}
+
+// DeviceDecisionRequest represents the user's decision on a device authorization
+// @Description Device authorization decision payload
+type DeviceDecisionRequest struct {
+	UserCode string `json:"user_code" binding:"required" example:"WDJB-MJHT"`
+	Approve  bool   `json:"approve" example:"true"`
+}
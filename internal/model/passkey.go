@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+)
+
+// PasskeyCredential represents a WebAuthn credential registered by a user
+// @Description Registered passkey information
+type PasskeyCredential struct {
+	ID              uint       `gorm:"primaryKey" json:"id" example:"1"`
+	UserID          uint       `gorm:"index;not null" json:"user_id" example:"1"`
+	Name            string     `gorm:"size:100" json:"name" example:"MacBook Touch ID"`
+	CredentialID    []byte     `gorm:"type:varbinary(255);uniqueIndex;not null" json:"-"`
+	PublicKey       []byte     `gorm:"type:blob;not null" json:"-"` // COSE encoded
+	AttestationType string     `gorm:"size:32" json:"-"`
+	AAGUID          []byte     `gorm:"type:varbinary(16)" json:"-"`
+	SignCount       uint32     `json:"sign_count" example:"12"`
+	Transports      string     `gorm:"size:255" json:"transports" example:"internal,hybrid"` // Comma separated
+	BackupEligible  bool       `json:"backup_eligible" example:"true"`
+	BackupState     bool       `json:"backup_state" example:"true"`
+	CreatedAt       time.Time  `json:"created_at" example:"2023-01-01T00:00:00Z"`
+	LastUsedAt      *time.Time `json:"last_used_at,omitempty" example:"2023-01-02T00:00:00Z"`
+}
+
+// PasskeyRegistrationRequest represents the final step of a passkey registration ceremony
+// @Description Passkey registration ceremony response payload
+type PasskeyRegistrationRequest struct {
+	CeremonyID string      `json:"ceremony_id" binding:"required" example:"4f1c2e9a7b3d5e6f"`
+	Name       string      `json:"name" binding:"max=100" example:"MacBook Touch ID"`
+	Credential interface{} `json:"credential" binding:"required" swaggertype:"object"` // PublicKeyCredential from navigator.credentials.create()
+}
+
+// PasskeyLoginRequest represents the final step of a passkey login ceremony
+// @Description Passkey login ceremony response payload
+type PasskeyLoginRequest struct {
+	CeremonyID string      `json:"ceremony_id" binding:"required" example:"4f1c2e9a7b3d5e6f"`
+	DeviceName string      `json:"device_name,omitempty" binding:"max=255" example:"John's laptop"`
+	Credential interface{} `json:"credential" binding:"required" swaggertype:"object"` // PublicKeyCredential from navigator.credentials.get()
+}
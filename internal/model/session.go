@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+)
+
+// Session represents a logged-in device, backed by one refresh token family
+// @Description Device session information
+type Session struct {
+	ID         uint       `gorm:"primaryKey" json:"id" example:"1"`
+	UserID     uint       `gorm:"index;not null" json:"user_id" example:"1"`
+	FamilyID   string     `gorm:"uniqueIndex;size:64;not null" json:"-"` // Refresh token family, also the "sid" claim
+	DeviceName string     `gorm:"size:255" json:"device_name" example:"John's laptop"`
+	IPAddress  string     `gorm:"size:45" json:"ip_address" example:"203.0.113.10"`
+	UserAgent  string     `gorm:"size:512" json:"user_agent" example:"Mozilla/5.0 (X11; Linux x86_64)"`
+	ClientID   string     `gorm:"index;size:64" json:"client_id,omitempty" example:"c2f7a9e4b1d3f5a7c9e1b3d5f7a9c1e3"` // OAuth client, empty for first-party logins
+	Scope      string     `gorm:"size:512" json:"scope,omitempty" example:"openid email"`
+	ParentID   string     `gorm:"index;size:64" json:"-"` // Family of the login session that approved the OAuth client; ends with it
+	CreatedAt  time.Time  `json:"created_at" example:"2023-01-01T00:00:00Z"`
+	LastUsedAt time.Time  `json:"last_used_at" example:"2023-01-02T00:00:00Z"`
+	ExpiresAt  time.Time  `json:"expires_at" example:"2023-01-09T00:00:00Z"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" example:"2023-01-03T00:00:00Z"`
+	Current    bool       `gorm:"-" json:"current" example:"true"` // Whether the session belongs to the requesting token
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"time"
+)
+
+// RefreshToken represents an issued refresh token belonging to a rotation family
+// @Description Refresh token record used for rotation and reuse detection
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id" example:"1"`
+	TokenID   string     `gorm:"uniqueIndex;size:64;not null" json:"-"` // jti of the signed token
+	FamilyID  string     `gorm:"index;size:64;not null" json:"family_id" example:"9f86d081884c7d65"`
+	UserID    uint       `gorm:"index;not null" json:"user_id" example:"1"`
+	ExpiresAt time.Time  `json:"expires_at" example:"2023-01-08T00:00:00Z"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty" example:"2023-01-02T00:00:00Z"` // Set once exchanged for a successor
+	RevokedAt *time.Time `json:"revoked_at,omitempty" example:"2023-01-02T00:00:00Z"`
+	CreatedAt time.Time  `json:"created_at" example:"2023-01-01T00:00:00Z"`
+}
+
+// PasswordResetToken represents a pending password reset. Only the SHA-256 hash of the token is stored.
+// @Description Password reset token record
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id" example:"1"`
+	UserID    uint       `gorm:"index;not null" json:"user_id" example:"1"`
+	TokenHash string     `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at" example:"2023-01-01T00:30:00Z"`
+	UsedAt    *time.Time `json:"used_at,omitempty" example:"2023-01-01T00:10:00Z"`
+	CreatedAt time.Time  `json:"created_at" example:"2023-01-01T00:00:00Z"`
+}
+
+// PersonalAccessToken represents a long-lived bearer token a user created for scripts and
+// tools. Only the SHA-256 hash of the token is stored.
+// @Description Personal access token
+type PersonalAccessToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id" example:"1"`
+	UserID     uint       `gorm:"index;not null" json:"user_id" example:"1"`
+	Name       string     `gorm:"size:100;not null" json:"name" example:"Deploy script"`
+	TokenHash  string     `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	Prefix     string     `gorm:"size:16;not null" json:"prefix" example:"pat_3f9a1c2e"` // Start of the token, to recognise it
+	Scope      string     `gorm:"size:255" json:"scope,omitempty" example:"read"`        // Space separated, empty for the user's full access
+	ExpiresAt  time.Time  `gorm:"index" json:"expires_at" example:"2023-02-01T00:00:00Z"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" example:"2023-01-02T00:00:00Z"`
+	LastUsedIP string     `gorm:"size:45" json:"last_used_ip,omitempty" example:"203.0.113.10"`
+	CreatedAt  time.Time  `json:"created_at" example:"2023-01-01T00:00:00Z"`
+}
+
+// CreatePersonalAccessTokenRequest represents a new personal access token
+// @Description Personal access token creation payload
+type CreatePersonalAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100" example:"Deploy script"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=365" example:"30"`        // Defaults to 30
+	Scopes        []string `json:"scopes" binding:"omitempty,dive,oneof=read write admin" example:"read"` // Defaults to the user's full access
+}
@@ -20,22 +20,25 @@ type Role struct {
 // User represents a user in the system
 // @Description User account information
 type User struct {
-	ID        uint           `gorm:"primaryKey" json:"id" example:"1"`
-	Username  string         `gorm:"unique;not null" json:"username" binding:"required,min=3" example:"john_doe"`
-	Email     string         `gorm:"unique;not null" json:"email" binding:"required,email" example:"john@example.com"`
-	Password  string         `gorm:"not null" json:"-"` // Exclude from JSON
-	RoleID    uint           `gorm:"not null" json:"role_id" binding:"required" example:"1"`
-	Role      Role           `gorm:"foreignKey:RoleID" json:"role"`
-	CreatedAt time.Time      `json:"created_at" example:"2023-01-01T00:00:00Z"`
-	UpdatedAt time.Time      `json:"updated_at" example:"2023-01-01T00:00:00Z"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"` // Soft delete
+	ID              uint           `gorm:"primaryKey" json:"id" example:"1"`
+	Username        string         `gorm:"unique;not null" json:"username" binding:"required,min=3" example:"john_doe"`
+	Email           string         `gorm:"unique;not null" json:"email" binding:"required,email" example:"john@example.com"`
+	Password        string         `gorm:"not null" json:"-"` // Exclude from JSON; empty when the user signs in by other means only
+	EmailVerifiedAt *time.Time     `json:"email_verified_at,omitempty" example:"2023-01-01T00:00:00Z"`
+	RoleID          uint           `gorm:"not null" json:"role_id" binding:"required" example:"1"`
+	Role            Role           `gorm:"foreignKey:RoleID" json:"role"`
+	CreatedAt       time.Time      `json:"created_at" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt       time.Time      `json:"updated_at" example:"2023-01-01T00:00:00Z"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"` // Soft delete
 }
 
 // LoginRequest represents the login request payload
 // @Description Login request payload
 type LoginRequest struct {
-	Email    string `json:"email" binding:"required,email" example:"john@example.com"`
-	Password string `json:"password" binding:"required" example:"password123"`
+	// Email, or with LDAP configured any login the directory's user filter accepts
+	Email      string `json:"email" binding:"required,max=255" example:"john@example.com"`
+	Password   string `json:"password" binding:"required" example:"password123"`
+	DeviceName string `json:"device_name,omitempty" binding:"max=255" example:"John's laptop"`
 }
 
 // RegisterRequest represents the registration request payload
@@ -52,6 +55,51 @@ type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
 }
 
+// VerifyEmailRequest represents the email verification request payload
+// @Description Email verification request payload
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+}
+
+// ResendVerificationRequest represents the verification email resend request payload
+// @Description Verification email resend request payload
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email" example:"john@example.com"`
+}
+
+// MagicLinkRequest represents the magic sign-in link request payload
+// @Description Magic link request payload
+type MagicLinkRequest struct {
+	Email      string `json:"email" binding:"required,email" example:"john@example.com"`
+	DeviceName string `json:"device_name,omitempty" binding:"max=255" example:"John's laptop"`
+}
+
+// MagicLinkConsumeRequest represents the magic link sign-in payload
+// @Description Magic link consume payload
+type MagicLinkConsumeRequest struct {
+	Token string `json:"token" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+}
+
+// ForgotPasswordRequest represents the password reset request payload
+// @Description Forgot password request payload
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email" example:"john@example.com"`
+}
+
+// ResetPasswordRequest represents the password reset confirmation payload
+// @Description Password reset payload
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required" example:"3f5a9c0e2b7d4f18a6c3e9b1d0f27a84"`
+	Password string `json:"password" binding:"required,min=8" example:"newpassword123"`
+}
+
+// ChangePasswordRequest represents the authenticated password change payload
+// @Description Change password payload
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required" example:"password123"`
+	NewPassword     string `json:"new_password" binding:"required,min=8" example:"newpassword123"`
+}
+
 // UpdateProfileRequest represents the profile update request payload
 // @Description Profile update request payload
 type UpdateProfileRequest struct {
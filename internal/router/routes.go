@@ -1,11 +1,17 @@
 package router
 
 import (
+	"crypto/rsa"
+	"crypto/x509"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/shahariaz/gin-auth-service/internal/config"
 	"github.com/shahariaz/gin-auth-service/internal/database"
 	"github.com/shahariaz/gin-auth-service/internal/handler"
 	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/mail"
 	"github.com/shahariaz/gin-auth-service/internal/middleware"
 	"github.com/shahariaz/gin-auth-service/internal/service"
 	"github.com/shahariaz/gin-auth-service/internal/validation"
@@ -21,40 +27,211 @@ func SetupRoutes(r *gin.Engine, cfg *config.Config, db *database.Database, log *
 	if err != nil {
 		log.Fatalf("Failed to connect to Redis: %v", err)
 	}
+	ceremonyStore, err := lib.NewRedisCeremonyStore("localhost:6379")
+	if err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
+	}
+	deviceCodeStore, err := lib.NewRedisDeviceCodeStore("localhost:6379")
+	if err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
+	}
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthnRPID,
+		RPDisplayName: cfg.WebAuthnRPName,
+		RPOrigins:     cfg.WebAuthnOrigins,
+	})
+	if err != nil {
+		log.Fatalf("Failed to configure WebAuthn: %v", err)
+	}
+	var keySet *lib.KeySet
+	if cfg.JWTKeysDir != "" {
+		keySet, err = lib.LoadKeySet(cfg.JWTKeysDir, cfg.JWTActiveKeyID)
+	} else {
+		log.Warn("JWT_KEYS_DIR not set, using an ephemeral signing key; access tokens will not survive a restart")
+		keySet, err = lib.NewEphemeralKeySet()
+	}
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+	var samlKey *rsa.PrivateKey
+	var samlCert *x509.Certificate
+	if cfg.SAMLCertFile != "" {
+		samlKey, samlCert, err = lib.LoadRSAKeyPair(cfg.SAMLCertFile, cfg.SAMLKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load SAML service provider key pair: %v", err)
+		}
+	}
+	var ldapRootCAs *x509.CertPool
+	if cfg.LDAP.CAFile != "" {
+		ldapRootCAs, err = lib.LoadCertPool(cfg.LDAP.CAFile)
+		if err != nil {
+			log.Fatalf("Failed to load LDAP CA certificates: %v", err)
+		}
+	}
+	mailer, err := mail.NewSender(cfg.MailDriver, cfg.MailFrom, cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailDir, log)
+	if err != nil {
+		log.Fatalf("Failed to configure mail sender: %v", err)
+	}
 	validator := validation.NewValidator()
-	userService := service.NewUserService(db, validator, log)
-	authService := service.NewAuthService(db, validator, tokenStore, cfg.JWT_SECRET, log)
+	logoutService := service.NewBackchannelLogoutService(db, keySet, cfg.IssuerURL, log)
+	logoutService.Start(30 * time.Second)
+	sessionService := service.NewSessionService(db, tokenStore, logoutService, log)
+	userService := service.NewUserService(db, validator, sessionService, log)
+	mfaService := service.NewMFAService(db, cfg.MFAIssuer, log)
+	verificationService := service.NewVerificationService(db, tokenStore, mailer, cfg.FrontendURL, cfg.RequireEmailVerification, cfg.IssuerURL, cfg.JWT_SECRET, log)
+	passwordService := service.NewPasswordService(db, sessionService, mailer, cfg.FrontendURL, log)
+	identityService := service.NewIdentityService(db, log)
+	ldapService := service.NewLDAPService(cfg.LDAP, ldapRootCAs, identityService, db, log)
+	available := map[string]service.Authenticator{
+		service.MethodPassword: service.NewPasswordAuthenticator(db, ldapService),
+		service.MethodLDAP:     ldapService,
+	}
+	authenticators := make([]service.Authenticator, 0, len(cfg.Authenticators))
+	for _, name := range cfg.Authenticators {
+		authenticators = append(authenticators, available[name])
+	}
+	authService := service.NewAuthService(db, validator, tokenStore, sessionService, mfaService, verificationService, authenticators, keySet, cfg.IssuerURL, cfg.OIDCClientID, cfg.JWT_SECRET, log)
+	passkeyService := service.NewPasskeyService(db, webAuthn, ceremonyStore, log)
+	magicLinkService := service.NewMagicLinkService(db, tokenStore, mailer, cfg.FrontendURL, cfg.IssuerURL, cfg.JWT_SECRET, log)
+	oauthClientService := service.NewOAuthClientService(db, cfg.InitialAccessToken, log)
+	federationService := service.NewFederationService(cfg.OIDCProviders, identityService, ceremonyStore, cfg.IssuerURL, log)
+	samlService := service.NewSAMLService(cfg.SAMLProviders, samlKey, samlCert, identityService, ceremonyStore, cfg.IssuerURL, log)
+	grantService := service.NewGrantService(db, sessionService, log)
+	tokenService := service.NewPersonalAccessTokenService(db, log)
+	deviceService := service.NewDeviceService(db, oauthClientService, authService, grantService, deviceCodeStore, cfg.FrontendURL, log)
+	oauthService := service.NewOAuthService(db, oauthClientService, authService, deviceService, grantService, ceremonyStore, log)
 	userHandler := handler.NewUserHandler(userService, log)
 	authHandler := handler.NewAuthHandler(authService, log)
+	sessionHandler := handler.NewSessionHandler(sessionService, log)
+	mfaHandler := handler.NewMFAHandler(mfaService, log)
+	passkeyHandler := handler.NewPasskeyHandler(passkeyService, authService, log)
+	verificationHandler := handler.NewVerificationHandler(verificationService, log)
+	passwordHandler := handler.NewPasswordHandler(passwordService, log)
+	magicLinkHandler := handler.NewMagicLinkHandler(magicLinkService, authService, cfg.GinMode == "release", log)
+	wellKnownHandler := handler.NewWellKnownHandler(keySet, cfg.IssuerURL, log)
+	oauthHandler := handler.NewOAuthHandler(oauthService, cfg.FrontendURL, log)
+	oauthClientHandler := handler.NewOAuthClientHandler(oauthClientService, logoutService, log)
+	registrationHandler := handler.NewRegistrationHandler(oauthClientService, cfg.IssuerURL, log)
+	deviceHandler := handler.NewDeviceHandler(deviceService, log)
+	grantHandler := handler.NewGrantHandler(grantService, log)
+	federationHandler := handler.NewFederationHandler(federationService, authService, cfg.GinMode == "release", log)
+	samlHandler := handler.NewSAMLHandler(samlService, authService, log)
+	identityHandler := handler.NewIdentityHandler(identityService, federationService, samlService, cfg.GinMode == "release", log)
+	tokenHandler := handler.NewPersonalAccessTokenHandler(tokenService, log)
+
+	authMiddleware := middleware.JWTAuthMiddleware(keySet, cfg.IssuerURL, tokenStore, tokenService, log)
+
+	// Discovery routes
+	r.GET("/.well-known/jwks.json", wellKnownHandler.JWKS)
+	r.GET("/.well-known/openid-configuration", wellKnownHandler.OpenIDConfiguration)
+	r.GET("/userinfo", authMiddleware, middleware.RequireUser(log), userHandler.UserInfo)
+
+	// OAuth routes
+	r.GET("/oauth/authorize", oauthHandler.Authorize)
+	r.POST("/oauth/token", oauthHandler.Token)
+	r.POST("/oauth/device_authorization", deviceHandler.DeviceAuthorization)
+	r.POST("/oauth/introspect", oauthHandler.Introspect)
+	r.POST("/oauth/revoke", oauthHandler.Revoke)
+	r.POST("/oauth/register", registrationHandler.Register)
+	r.GET("/oauth/register/:client_id", registrationHandler.GetRegistration)
+	r.PUT("/oauth/register/:client_id", registrationHandler.UpdateRegistration)
+	r.DELETE("/oauth/register/:client_id", registrationHandler.DeleteRegistration)
 
 	// Public routes
 	r.POST("/register", authHandler.Register)
 	r.POST("/login", authHandler.Login)
+	r.POST("/login/mfa", authHandler.LoginMFA)
+	r.POST("/login/passkey/begin", passkeyHandler.BeginLogin)
+	r.POST("/login/passkey/finish", passkeyHandler.FinishLogin)
+	r.POST("/login/magic-link", magicLinkHandler.RequestMagicLink)
+	r.GET("/login/magic-link/consume", magicLinkHandler.ConsumeMagicLink)
+	r.POST("/login/magic-link/consume", magicLinkHandler.ConsumeMagicLink)
+	r.GET("/login/oidc", federationHandler.ListProviders)
+	r.GET("/login/oidc/:provider", federationHandler.BeginLogin)
+	r.GET("/login/oidc/:provider/callback", federationHandler.Callback)
+	r.GET("/login/saml", samlHandler.ListProviders)
+	r.GET("/login/saml/:provider", samlHandler.BeginLogin)
+	r.GET("/login/saml/:provider/metadata", samlHandler.Metadata)
+	r.POST("/login/saml/:provider/acs", samlHandler.AssertionConsumer)
 	r.POST("/refresh", authHandler.RefreshToken)
 	r.POST("/logout", authHandler.Logout)
+	r.POST("/verify-email", verificationHandler.VerifyEmail)
+	r.POST("/verify-email/resend", verificationHandler.ResendVerification)
+	r.POST("/password/forgot", passwordHandler.ForgotPassword)
+	r.POST("/password/reset", passwordHandler.ResetPassword)
 
 	// Swagger documentation (only in development mode)
 	if cfg.GinMode == "debug" || cfg.GinMode != "release" {
 		r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	}
 
-	// Protected routes
+	// Protected routes, acting on the token's user; tokens issued to OAuth clients are limited
+	// to userinfo and the admin scope
 	api := r.Group("/api")
-	api.Use(middleware.JWTAuthMiddleware(cfg.JWT_SECRET, tokenStore, log))
+	api.Use(authMiddleware, middleware.RequireUser(log), middleware.RequireFirstParty(log))
 	{
 		// User profile routes
 		api.GET("/profile", userHandler.GetProfile)
 		api.PUT("/profile", userHandler.UpdateProfile)
 		api.DELETE("/profile", userHandler.DeleteProfile)
+		api.PUT("/profile/password", passwordHandler.ChangePassword)
 
-		// Admin routes
-		admin := api.Group("/admin")
-		admin.Use(middleware.RequireRole("admin", log))
-		{
-			admin.GET("/users", userHandler.ListUsers)
-			admin.POST("/users", userHandler.CreateUser)
-			admin.PUT("/users/:id", userHandler.UpdateUser)
-			admin.DELETE("/users/:id", userHandler.DeleteUser)
-		}
+		// MFA routes
+		api.GET("/profile/mfa", mfaHandler.GetStatus)
+		api.POST("/profile/mfa/totp", mfaHandler.EnrollTOTP)
+		api.POST("/profile/mfa/totp/confirm", mfaHandler.ConfirmTOTP)
+		api.DELETE("/profile/mfa/totp", mfaHandler.DisableTOTP)
+
+		// Passkey routes
+		api.GET("/profile/passkeys", passkeyHandler.ListPasskeys)
+		api.POST("/profile/passkeys/register/begin", passkeyHandler.BeginRegistration)
+		api.POST("/profile/passkeys/register/finish", passkeyHandler.FinishRegistration)
+		api.DELETE("/profile/passkeys/:id", passkeyHandler.DeletePasskey)
+
+		// Login method routes
+		api.GET("/profile/identities", identityHandler.ListIdentities)
+		api.POST("/profile/identities/:provider/link", identityHandler.LinkIdentity)
+		api.DELETE("/profile/identities/:id", identityHandler.UnlinkIdentity)
+
+		// Personal access token routes
+		api.GET("/profile/tokens", tokenHandler.ListTokens)
+		api.POST("/profile/tokens", tokenHandler.CreateToken)
+		api.DELETE("/profile/tokens/:id", tokenHandler.RevokeToken)
+
+		// Application grant routes
+		api.GET("/profile/grants", grantHandler.ListGrants)
+		api.DELETE("/profile/grants/:client_id", grantHandler.RevokeGrant)
+
+		// OAuth routes
+		api.GET("/oauth/authorize", oauthHandler.GetConsent)
+		api.POST("/oauth/authorize", oauthHandler.ApproveAuthorization)
+		api.GET("/oauth/device", deviceHandler.GetDeviceRequest)
+		api.POST("/oauth/device", deviceHandler.DecideDeviceRequest)
+
+		// Session routes
+		api.GET("/sessions", sessionHandler.ListSessions)
+		api.DELETE("/sessions/:id", sessionHandler.RevokeSession)
+		api.POST("/sessions/revoke-others", sessionHandler.RevokeOtherSessions)
+	}
+
+	// Admin routes, also open to service clients granted the admin scope
+	admin := r.Group("/api/admin")
+	admin.Use(authMiddleware, middleware.RequireRoleOrScope("admin", "admin", log))
+	{
+		admin.GET("/users", userHandler.ListUsers)
+		admin.POST("/users", userHandler.CreateUser)
+		admin.PUT("/users/:id", userHandler.UpdateUser)
+		admin.DELETE("/users/:id", userHandler.DeleteUser)
+		admin.GET("/users/:id/sessions", sessionHandler.ListUserSessions)
+		admin.DELETE("/users/:id/sessions", sessionHandler.RevokeUserSessions)
+		admin.DELETE("/users/:id/sessions/:session_id", sessionHandler.RevokeUserSession)
+		admin.GET("/users/:id/tokens", tokenHandler.ListUserTokens)
+		admin.DELETE("/users/:id/tokens/:token_id", tokenHandler.RevokeUserToken)
+		admin.GET("/oauth/clients", oauthClientHandler.ListClients)
+		admin.POST("/oauth/clients", oauthClientHandler.CreateClient)
+		admin.POST("/oauth/clients/:id/approve", oauthClientHandler.ApproveClient)
+		admin.POST("/oauth/clients/:id/disable", oauthClientHandler.DisableClient)
+		admin.DELETE("/oauth/clients/:id", oauthClientHandler.DeleteClient)
+		admin.GET("/oauth/logout-deliveries", oauthClientHandler.ListLogoutDeliveries)
 	}
 }
@@ -5,24 +5,55 @@ import (
 	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/shahariaz/gin-auth-service/internal/database"
 	"github.com/shahariaz/gin-auth-service/internal/lib"
 	"github.com/shahariaz/gin-auth-service/internal/model"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
+const (
+	mfaTokenPurpose = "mfa"
+	mfaTokenTTL     = 5 * time.Minute
+)
+
+var errRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// TokenPair is the access/refresh token pair returned to clients on login and refresh, along
+// with an OpenID Connect ID token for the frontend client
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// LoginResult carries either a token pair or, for users enrolled in MFA, a challenge token
+// that must be completed at /login/mfa
+type LoginResult struct {
+	User     *model.User
+	Method   string // Login method of the principal
+	Tokens   *TokenPair
+	MFAToken string
+}
+
 type AuthService struct {
-	db         *database.Database
-	validator  *validator.Validate
-	tokenStore lib.TokenStore
-	secret     []byte
-	log        *logrus.Logger
+	db             *database.Database
+	validator      *validator.Validate
+	tokenStore     lib.TokenStore
+	sessions       *SessionService
+	mfa            *MFAService
+	verification   *VerificationService
+	authenticators []Authenticator // Tried in order by Login
+	keys           *lib.KeySet
+	issuer         string
+	clientID       string // Audience of ID tokens issued by direct logins
+	secret         []byte
+	log            *logrus.Logger
 }
 
-func NewAuthService(db *database.Database, validator *validator.Validate, tokenStore lib.TokenStore, secret []byte, log *logrus.Logger) *AuthService {
-	return &AuthService{db: db, validator: validator, tokenStore: tokenStore, secret: secret, log: log}
+func NewAuthService(db *database.Database, validator *validator.Validate, tokenStore lib.TokenStore, sessions *SessionService, mfa *MFAService, verification *VerificationService, authenticators []Authenticator, keys *lib.KeySet, issuer, clientID string, secret []byte, log *logrus.Logger) *AuthService {
+	return &AuthService{db: db, validator: validator, tokenStore: tokenStore, sessions: sessions, mfa: mfa, verification: verification, authenticators: authenticators, keys: keys, issuer: issuer, clientID: clientID, secret: secret, log: log}
 }
 
 func (s *AuthService) Register(user *model.User, password string) error {
@@ -45,69 +76,348 @@ func (s *AuthService) Register(user *model.User, password string) error {
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
 
-	return s.db.Create(user).Error
+	if err := s.db.Create(user).Error; err != nil {
+		return err
+	}
+
+	// The account exists at this point; a failed email can be retried via /verify-email/resend
+	if err := s.verification.Send(user); err != nil {
+		s.log.WithError(err).WithField("user_id", user.ID).Error("Failed to send verification email")
+	}
+	return nil
 }
 
-func (s *AuthService) Login(email, password string) (*model.User, string, string, error) {
-	var user model.User
-	if err := s.db.Preload("Role").Where("email = ?", email).First(&user).Error; err != nil {
-		return nil, "", "", errors.New("user not found")
+// Login runs the credentials through the authenticator chain: the first authenticator that
+// accepts or rejects them decides, and a login every authenticator passes on is unknown.
+func (s *AuthService) Login(login, password string, info SessionInfo) (*LoginResult, error) {
+	credentials := Credentials{Login: login, Password: password}
+	for _, authenticator := range s.authenticators {
+		principal, err := authenticator.Authenticate(credentials)
+		if errors.Is(err, ErrPass) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return s.CompleteLogin(principal, info)
+	}
+	return nil, errors.New("user not found")
+}
+
+// CompleteLogin finishes a login after a single-factor check (password, email link, external
+// provider, passkey): unverified users are refused while verification is required, users
+// enrolled in MFA get a challenge, everyone else a new session.
+func (s *AuthService) CompleteLogin(principal *Principal, info SessionInfo) (*LoginResult, error) {
+	user := principal.User
+	if s.verification.Required() && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+	mfaEnabled, err := s.mfa.IsEnabled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mfaEnabled {
+		mfaToken, err := lib.GeneratePurposeToken(mfaTokenPurpose, user.ID, mfaTokenTTL,
+			map[string]string{"device_name": info.DeviceName}, s.issuer, s.secret)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{User: user, Method: principal.Method, MFAToken: mfaToken}, nil
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, "", "", errors.New("invalid password")
+	tokens, err := s.StartSession(user, info)
+	if err != nil {
+		return nil, err
 	}
 
-	accessToken, err := lib.GenerateAccessToken(user.ID, user.Username, user.Role.Name, s.secret)
+	return &LoginResult{User: user, Method: principal.Method, Tokens: tokens}, nil
+}
+
+// CompleteMFALogin exchanges an MFA challenge token and a TOTP code for a token pair.
+// The challenge is single-use: a wrong code burns it and the user has to log in again.
+func (s *AuthService) CompleteMFALogin(mfaToken, code string, info SessionInfo) (*model.User, *TokenPair, error) {
+	claims, err := lib.ParsePurposeToken(mfaToken, mfaTokenPurpose, s.issuer, s.secret)
 	if err != nil {
-		return nil, "", "", err
+		return nil, nil, err
 	}
 
-	refreshToken, err := lib.GenerateRefreshToken(user.ID, user.Username, s.secret)
+	fresh, err := s.tokenStore.Consume(claims.ID, mfaTokenTTL)
 	if err != nil {
-		return nil, "", "", err
+		return nil, nil, err
+	}
+	if !fresh {
+		return nil, nil, errors.New("mfa token already used")
+	}
+
+	if err := s.mfa.Verify(claims.UserID, code); err != nil {
+		s.log.WithFields(logrus.Fields{
+			"event":   "mfa_failed",
+			"user_id": claims.UserID,
+			"ip":      info.IPAddress,
+		}).Warn("Security event: invalid MFA code at login")
+		return nil, nil, err
+	}
+
+	var user model.User
+	if err := s.db.Preload("Role").Where("id = ?", claims.UserID).First(&user).Error; err != nil {
+		return nil, nil, errors.New("user not found")
 	}
 
-	return &user, accessToken, refreshToken, nil
+	if info.DeviceName == "" {
+		info.DeviceName = claims.Data["device_name"]
+	}
+	tokens, err := s.StartSession(&user, info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &user, tokens, nil
 }
 
-func (s *AuthService) RefreshToken(refreshToken string) (string, error) {
+// RefreshToken rotates a refresh token: the presented token is marked as rotated and
+// a new access/refresh pair from the same family is returned. Presenting a token that
+// was already rotated revokes the whole family. clientID is the OAuth client presenting
+// the token, empty for the first-party frontend; it must match the client the session was
+// granted to.
+func (s *AuthService) RefreshToken(refreshToken, clientID string, info SessionInfo) (*TokenPair, error) {
 	isBlacklisted, err := s.tokenStore.IsBlacklisted(refreshToken)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if isBlacklisted {
-		return "", errors.New("refresh token blacklisted")
+		return nil, errors.New("refresh token blacklisted")
 	}
 
-	token, err := jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return s.secret, nil
-	})
-	if err != nil || !token.Valid {
-		return "", errors.New("invalid refresh token")
+	claims, err := lib.ParseRefreshToken(refreshToken, s.issuer, s.secret)
+	if err != nil {
+		return nil, err
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || claims["username"] == nil || claims["user_id"] == nil {
-		return "", errors.New("invalid token claims")
+	var stored model.RefreshToken
+	if err := s.db.Where("token_id = ?", claims.ID).First(&stored).Error; err != nil {
+		return nil, errors.New("invalid refresh token")
+	}
+	if stored.RotatedAt != nil {
+		s.handleTokenReuse(&stored)
+		return nil, errRefreshTokenReused
+	}
+	if stored.RevokedAt != nil {
+		return nil, errors.New("refresh token revoked")
+	}
+
+	session, err := s.sessions.Get(stored.FamilyID)
+	if err != nil {
+		return nil, errors.New("session not found")
+	}
+	if session.ClientID != clientID {
+		return nil, errors.New("refresh token was not issued to this client")
 	}
 
 	var user model.User
-	if err := s.db.Preload("Role").Where("id = ?", uint(claims["user_id"].(float64))).First(&user).Error; err != nil {
-		return "", errors.New("user not found")
+	if err := s.db.Preload("Role").Where("id = ?", stored.UserID).First(&user).Error; err != nil {
+		return nil, errors.New("user not found")
 	}
 
-	accessToken, err := lib.GenerateAccessToken(user.ID, user.Username, user.Role.Name, s.secret)
+	var tokens *TokenPair
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Conditional update so that two concurrent refreshes cannot both rotate the same token
+		result := tx.Model(&model.RefreshToken{}).
+			Where("id = ? AND rotated_at IS NULL AND revoked_at IS NULL", stored.ID).
+			Update("rotated_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+
+		if err := s.sessions.Touch(tx, stored.FamilyID, info); err != nil {
+			return err
+		}
+		var err error
+		tokens, err = s.issueTokens(tx, &user, sessionGrant(session), "")
+		return err
+	})
+	if errors.Is(err, errRefreshTokenReused) {
+		s.handleTokenReuse(&stored)
+		return nil, err
+	}
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return accessToken, nil
+	return tokens, nil
 }
 
 func (s *AuthService) Logout(refreshToken string) error {
-	return s.tokenStore.Blacklist(refreshToken, 7*24*time.Hour)
+	claims, err := lib.ParseRefreshToken(refreshToken, s.issuer, s.secret)
+	if err != nil {
+		return err
+	}
+	if err := s.sessions.RevokeFamily(claims.FamilyID); err != nil {
+		return err
+	}
+	return s.tokenStore.Blacklist(refreshToken, lib.RefreshTokenTTL)
+}
+
+// StartSession creates a new session (token family) for an already authenticated user and
+// issues its first token pair.
+func (s *AuthService) StartSession(user *model.User, info SessionInfo) (*TokenPair, error) {
+	return s.StartOAuthSession(user, info, "")
+}
+
+// StartOAuthSession is StartSession for a session granted to the OAuth client in info. The
+// nonce of the authorization request is included in the ID token.
+func (s *AuthService) StartOAuthSession(user *model.User, info SessionInfo, nonce string) (*TokenPair, error) {
+	familyID, err := lib.NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens *TokenPair
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.sessions.Create(tx, user.ID, familyID, info); err != nil {
+			return err
+		}
+		var err error
+		grant := lib.Grant{SessionID: familyID, ClientID: info.ClientID, Scope: info.Scope}
+		tokens, err = s.issueTokens(tx, user, grant, nonce)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// ActiveAccessToken verifies an access token of any audience, exchanged tokens included, and
+// checks that neither the token nor its session has been revoked.
+func (s *AuthService) ActiveAccessToken(accessToken string) (*lib.TokenClaims, error) {
+	claims, err := lib.ParseIssuedAccessToken(accessToken, s.issuer, s.keys)
+	if err != nil {
+		return nil, err
+	}
+	blacklisted, err := s.tokenStore.IsBlacklisted(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if blacklisted {
+		return nil, errors.New("token revoked")
+	}
+	if claims.SessionID != "" {
+		revoked, err := s.tokenStore.IsSessionRevoked(claims.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, errors.New("session revoked")
+		}
+	}
+	return claims, nil
+}
+
+// ActiveRefreshToken returns the claims and session of a refresh token that can still be exchanged.
+func (s *AuthService) ActiveRefreshToken(refreshToken string) (*lib.RefreshClaims, *model.Session, error) {
+	claims, err := lib.ParseRefreshToken(refreshToken, s.issuer, s.secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	blacklisted, err := s.tokenStore.IsBlacklisted(refreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if blacklisted {
+		return nil, nil, errors.New("refresh token blacklisted")
+	}
+	var stored model.RefreshToken
+	if err := s.db.Where("token_id = ? AND rotated_at IS NULL AND revoked_at IS NULL", claims.ID).First(&stored).Error; err != nil {
+		return nil, nil, errors.New("refresh token no longer active")
+	}
+	session, err := s.sessions.Get(claims.FamilyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return claims, session, nil
+}
+
+// RevokeAccessToken blacklists an access token for the rest of its lifetime.
+func (s *AuthService) RevokeAccessToken(accessToken string, claims *lib.TokenClaims) error {
+	ttl := time.Until(claims.ExpiresAt.Time)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.tokenStore.Blacklist(accessToken, ttl)
+}
+
+// IssueClientToken mints an access token for an OAuth client acting on its own behalf.
+func (s *AuthService) IssueClientToken(clientID, scope string) (string, error) {
+	return lib.GenerateClientToken(clientID, scope, s.issuer, s.keys)
+}
+
+// IssueDelegatedToken mints a token for clientID to call audience on behalf of the subject
+// token's user and returns it with its expiry.
+func (s *AuthService) IssueDelegatedToken(subject *lib.TokenClaims, clientID, scope, audience string) (string, time.Time, error) {
+	return lib.GenerateDelegatedToken(subject, clientID, scope, audience, s.issuer, s.keys)
+}
+
+// issueTokens mints an access token and a refresh token in the grant's family and persists the
+// refresh token. An ID token is added for the first-party frontend and for OAuth clients granted
+// the openid scope.
+func (s *AuthService) issueTokens(tx *gorm.DB, user *model.User, grant lib.Grant, nonce string) (*TokenPair, error) {
+	familyID := grant.SessionID
+	accessToken, err := lib.GenerateAccessToken(user.ID, user.Username, user.Role.Name, grant, s.issuer, s.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var idToken string
+	audience := s.clientID
+	if grant.ClientID != "" {
+		audience = grant.ClientID
+	}
+	if grant.ClientID == "" || hasScope(grant.Scope, "openid") {
+		idToken, err = lib.GenerateIDToken(user.ID, profileClaims(user), familyID, audience, nonce, s.issuer, s.keys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tokenID, err := lib.NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := lib.GenerateRefreshToken(user.ID, user.Username, tokenID, familyID, s.issuer, s.secret)
+	if err != nil {
+		return nil, err
+	}
+
+	record := model.RefreshToken{
+		TokenID:   tokenID,
+		FamilyID:  familyID,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(lib.RefreshTokenTTL),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{AccessToken: accessToken, RefreshToken: refreshToken, IDToken: idToken}, nil
+}
+
+func (s *AuthService) handleTokenReuse(token *model.RefreshToken) {
+	s.log.WithFields(logrus.Fields{
+		"event":     "refresh_token_reuse",
+		"user_id":   token.UserID,
+		"family_id": token.FamilyID,
+	}).Warn("Security event: rotated refresh token presented again, revoking token family")
+
+	if err := s.sessions.RevokeFamily(token.FamilyID); err != nil {
+		s.log.WithError(err).WithField("family_id", token.FamilyID).Error("Failed to revoke token family")
+	}
+}
+
+// sessionGrant returns what the tokens of a session are issued for.
+func sessionGrant(session *model.Session) lib.Grant {
+	return lib.Grant{SessionID: session.FamilyID, ClientID: session.ClientID, Scope: session.Scope}
 }
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shahariaz/gin-auth-service/internal/config"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+)
+
+func TestCompleteLoginRefusesUnverifiedEmail(t *testing.T) {
+	db := newTestDB(t)
+	log := newTestLogger()
+	noDirectory := NewLDAPService(config.LDAPConfig{}, nil, NewIdentityService(db, log), db, log)
+	auth, _ := newTestAuthService(t, db, NewPasswordAuthenticator(db, noDirectory))
+	auth.verification = NewVerificationService(db, newTestTokenStore(t), &testMailer{}, "https://app.example.com", true, testIssuer, []byte("test-secret"), log)
+
+	user := createTestUser(t, db, "jane", "jane@example.com", "password123", "user")
+	if err := db.Model(user).Omit("Role").Update("email_verified_at", nil).Error; err != nil {
+		t.Fatal(err)
+	}
+	user.EmailVerifiedAt = nil
+
+	if _, err := auth.Login("jane@example.com", "password123", SessionInfo{}); !errors.Is(err, ErrEmailNotVerified) {
+		t.Fatalf("password login: got %v, want ErrEmailNotVerified", err)
+	}
+	for _, method := range []string{MethodPasskey, MethodOIDC, MethodSAML} {
+		if _, err := auth.CompleteLogin(&Principal{User: user, Method: method}, SessionInfo{}); !errors.Is(err, ErrEmailNotVerified) {
+			t.Fatalf("%s login: got %v, want ErrEmailNotVerified", method, err)
+		}
+	}
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	result, err := auth.CompleteLogin(&Principal{User: user, Method: MethodPasskey}, SessionInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Method != MethodPasskey || result.Tokens == nil {
+		t.Fatalf("unexpected login result %+v", result)
+	}
+}
+
+func TestCompleteLoginChallengesMFAUsers(t *testing.T) {
+	db := newTestDB(t)
+	auth, _ := newTestAuthService(t, db)
+	user := createTestUser(t, db, "jane", "jane@example.com", "password123", "user")
+	now := time.Now()
+	if err := db.Create(&model.TOTPFactor{UserID: user.ID, Secret: "JBSWY3DPEHPK3PXP", ConfirmedAt: &now}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := auth.CompleteLogin(&Principal{User: user, Method: MethodPasskey}, SessionInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MFAToken == "" || result.Tokens != nil {
+		t.Fatalf("passkey login skipped the MFA challenge: %+v", result)
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Login methods, recorded on the principal of every login. The password-based ones are also
+// the names of the authenticators in LOGIN_AUTHENTICATORS.
+const (
+	MethodPassword  = "password"
+	MethodLDAP      = "ldap"
+	MethodMagicLink = "magic_link"
+	MethodOIDC      = "oidc"
+	MethodSAML      = "saml"
+	MethodPasskey   = "passkey"
+)
+
+// ErrPass is returned by an authenticator that has no opinion on a login (for example, it does
+// not know the user), so that the next authenticator in the chain gets to decide.
+var ErrPass = errors.New("authenticator does not handle this login")
+
+// Credentials are what a client presents to POST /login.
+type Credentials struct {
+	Login    string // Email, or any name an authenticator resolves (e.g. a directory username)
+	Password string
+}
+
+// Principal is an authenticated user and how they proved it. Every login, whichever method it
+// used, ends with a principal that AuthService.CompleteLogin turns into a session and tokens.
+type Principal struct {
+	User   *model.User
+	Method string
+}
+
+// Authenticator is one link of the chain behind AuthService.Login. It accepts the credentials
+// by returning a principal, rejects them by returning an error, or returns ErrPass. Only methods
+// that check a login and password are authenticators; flows with their own ceremony (OIDC,
+// SAML, magic links, passkeys) pass their principal to AuthService.CompleteLogin directly.
+type Authenticator interface {
+	Name() string
+	Authenticate(credentials Credentials) (*Principal, error)
+}
+
+// PasswordAuthenticator checks the local bcrypt password of the account with the login as
+// email. Accounts without a password, and unknown emails, are passed on.
+type PasswordAuthenticator struct {
+	db   *database.Database
+	ldap *LDAPService
+}
+
+// NewPasswordAuthenticator creates the local password authenticator. Accounts linked to the
+// directory are refused while LDAP is configured, so that disabling them there takes effect.
+func NewPasswordAuthenticator(db *database.Database, ldap *LDAPService) *PasswordAuthenticator {
+	return &PasswordAuthenticator{db: db, ldap: ldap}
+}
+
+func (a *PasswordAuthenticator) Name() string {
+	return MethodPassword
+}
+
+func (a *PasswordAuthenticator) Authenticate(credentials Credentials) (*Principal, error) {
+	var user model.User
+	if err := a.db.Preload("Role").Where("email = ?", credentials.Login).First(&user).Error; err != nil {
+		return nil, ErrPass
+	}
+	if user.Password == "" {
+		return nil, ErrPass
+	}
+	if a.ldap.Enabled() {
+		managed, err := a.ldap.Manages(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if managed {
+			return nil, errors.New("account is managed by the directory")
+		}
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(credentials.Password)); err != nil {
+		return nil, errors.New("invalid password")
+	}
+	return &Principal{User: &user, Method: MethodPassword}, nil
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	logoutMaxAttempts  = 5
+	logoutRetryBackoff = 30 * time.Second // Doubled after every failed attempt
+	logoutClaimLease   = time.Minute      // Keeps other workers off a delivery in flight
+	logoutBatchSize    = 100
+)
+
+// BackchannelLogoutService notifies OAuth clients when a session they hold ends (OIDC
+// Back-Channel Logout). Deliveries are recorded and retried with backoff until they succeed or
+// run out of attempts.
+type BackchannelLogoutService struct {
+	db     *database.Database
+	keys   *lib.KeySet
+	issuer string
+	client *http.Client
+	log    *logrus.Logger
+}
+
+func NewBackchannelLogoutService(db *database.Database, keys *lib.KeySet, issuer string, log *logrus.Logger) *BackchannelLogoutService {
+	return &BackchannelLogoutService{db: db, keys: keys, issuer: issuer, client: &http.Client{Timeout: 5 * time.Second}, log: log}
+}
+
+// Notify queues a logout token for every ended session held by a client with a back-channel
+// logout URI and attempts delivery in the background. Failures are logged, never returned:
+// the sessions are already revoked.
+func (s *BackchannelLogoutService) Notify(sessions []model.Session) {
+	var clientIDs []string
+	for _, session := range sessions {
+		if session.ClientID != "" {
+			clientIDs = append(clientIDs, session.ClientID)
+		}
+	}
+	if len(clientIDs) == 0 {
+		return
+	}
+
+	var clients []model.OAuthClient
+	if err := s.db.Where("client_id IN ? AND logout_uri <> ''", clientIDs).Find(&clients).Error; err != nil {
+		s.log.WithError(err).Error("Failed to load clients for back-channel logout")
+		return
+	}
+	logoutURIs := make(map[string]string, len(clients))
+	for _, client := range clients {
+		logoutURIs[client.ClientID] = client.LogoutURI
+	}
+
+	now := time.Now()
+	var deliveries []model.LogoutDelivery
+	for _, session := range sessions {
+		if uri, ok := logoutURIs[session.ClientID]; ok {
+			deliveries = append(deliveries, model.LogoutDelivery{
+				ClientID:      session.ClientID,
+				UserID:        session.UserID,
+				SessionID:     session.FamilyID,
+				URI:           uri,
+				Status:        model.LogoutDeliveryPending,
+				NextAttemptAt: now,
+			})
+		}
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+	if err := s.db.Create(&deliveries).Error; err != nil {
+		s.log.WithError(err).Error("Failed to queue back-channel logout")
+		return
+	}
+	go s.DeliverDue()
+}
+
+// Start retries due deliveries every interval, including those queued before a restart.
+func (s *BackchannelLogoutService) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.DeliverDue()
+		}
+	}()
+}
+
+// DeliverDue attempts every pending delivery whose next attempt is due.
+func (s *BackchannelLogoutService) DeliverDue() {
+	var due []model.LogoutDelivery
+	if err := s.db.Where("status = ? AND next_attempt_at <= ?", model.LogoutDeliveryPending, time.Now()).
+		Order("id").Limit(logoutBatchSize).Find(&due).Error; err != nil {
+		s.log.WithError(err).Error("Failed to load back-channel logout deliveries")
+		return
+	}
+	for i := range due {
+		s.attempt(&due[i])
+	}
+}
+
+// List returns the most recent deliveries, optionally only those with the given status.
+func (s *BackchannelLogoutService) List(status string) ([]model.LogoutDelivery, error) {
+	query := s.db.Order("id DESC").Limit(logoutBatchSize)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var deliveries []model.LogoutDelivery
+	if err := query.Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (s *BackchannelLogoutService) attempt(delivery *model.LogoutDelivery) {
+	now := time.Now()
+	// Claim the delivery so that a concurrent worker does not send it twice
+	result := s.db.Model(&model.LogoutDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, model.LogoutDeliveryPending, delivery.NextAttemptAt).
+		Update("next_attempt_at", now.Add(logoutClaimLease))
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+
+	err := s.send(delivery)
+	attempts := delivery.Attempts + 1
+	updates := map[string]interface{}{"attempts": attempts}
+	fields := logrus.Fields{"client_id": delivery.ClientID, "user_id": delivery.UserID, "attempt": attempts}
+	switch {
+	case err == nil:
+		updates["status"] = model.LogoutDeliveryDelivered
+		updates["delivered_at"] = time.Now()
+		updates["last_error"] = ""
+		s.log.WithFields(fields).Info("Back-channel logout delivered")
+	case attempts >= logoutMaxAttempts:
+		updates["status"] = model.LogoutDeliveryFailed
+		updates["last_error"] = truncate(err.Error(), 512)
+		s.log.WithFields(fields).WithError(err).Error("Back-channel logout failed, giving up")
+	default:
+		updates["next_attempt_at"] = now.Add(logoutRetryBackoff << (attempts - 1))
+		updates["last_error"] = truncate(err.Error(), 512)
+		s.log.WithFields(fields).WithError(err).Warn("Back-channel logout failed, will retry")
+	}
+	if err := s.db.Model(&model.LogoutDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+		s.log.WithError(err).Error("Failed to record back-channel logout delivery")
+	}
+}
+
+// send posts a fresh logout token, so that retries are not rejected as expired.
+func (s *BackchannelLogoutService) send(delivery *model.LogoutDelivery) error {
+	token, err := lib.GenerateLogoutToken(delivery.UserID, delivery.SessionID, delivery.ClientID, s.issuer, s.keys)
+	if err != nil {
+		return err
+	}
+	form := url.Values{"logout_token": {token}}
+	resp, err := s.client.Post(delivery.URI, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// validateLogoutURI checks a client's back-channel logout URI (absolute, without fragment).
+func validateLogoutURI(uri string) error {
+	parsed, err := url.Parse(uri)
+	if err != nil || !parsed.IsAbs() || parsed.Fragment != "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+		return errors.New("backchannel_logout_uri must be an absolute http(s) URL without fragment")
+	}
+	return nil
+}
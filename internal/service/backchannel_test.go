@@ -0,0 +1,171 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+)
+
+// logoutReceiver is a client back-channel logout endpoint answering with a fixed status.
+type logoutReceiver struct {
+	mu     sync.Mutex
+	status int
+	tokens []string
+}
+
+func (r *logoutReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens = append(r.tokens, req.PostFormValue("logout_token"))
+	w.WriteHeader(r.status)
+}
+
+func (r *logoutReceiver) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.tokens...)
+}
+
+func newTestLogoutService(t *testing.T, status int) (*BackchannelLogoutService, *database.Database, *lib.KeySet, *logoutReceiver) {
+	t.Helper()
+	db := newTestDB(t)
+	keys, err := lib.NewEphemeralKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver := &logoutReceiver{status: status}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	client := model.OAuthClient{ClientID: "app", Name: "App", Type: model.OAuthClientConfidential, LogoutURI: server.URL + "/logout"}
+	if err := db.Create(&client).Error; err != nil {
+		t.Fatal(err)
+	}
+	return NewBackchannelLogoutService(db, keys, testIssuer, newTestLogger()), db, keys, receiver
+}
+
+// waitForDelivery waits until the delivery has been attempted the given number of times.
+func waitForDelivery(t *testing.T, db *database.Database, attempts int) model.LogoutDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var delivery model.LogoutDelivery
+		if err := db.First(&delivery).Error; err == nil && delivery.Attempts >= attempts {
+			return delivery
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery not attempted %d times", attempts)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBackchannelLogoutDelivery(t *testing.T) {
+	svc, db, keys, receiver := newTestLogoutService(t, http.StatusOK)
+
+	svc.Notify([]model.Session{
+		{UserID: 7, FamilyID: "family-1", ClientID: "app"},
+		{UserID: 7, FamilyID: "family-2"}, // First-party session, nobody to notify
+	})
+	delivery := waitForDelivery(t, db, 1)
+	if delivery.Status != model.LogoutDeliveryDelivered || delivery.DeliveredAt == nil {
+		t.Fatalf("delivery %+v, want delivered", delivery)
+	}
+
+	tokens := receiver.received()
+	if len(tokens) != 1 {
+		t.Fatalf("received %d logout tokens, want 1", len(tokens))
+	}
+	var claims lib.LogoutTokenClaims
+	token, err := jwt.ParseWithClaims(tokens[0], &claims, keys.Keyfunc,
+		jwt.WithValidMethods(keys.ValidMethods()), jwt.WithIssuer(testIssuer), jwt.WithAudience("app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["typ"] != "logout+jwt" {
+		t.Errorf("typ header %v, want logout+jwt", token.Header["typ"])
+	}
+	if claims.SessionID != "family-1" || claims.Subject != lib.Subject(7) || claims.ID == "" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	if _, ok := claims.Events[lib.BackchannelLogoutEvent]; !ok || len(claims.Events) != 1 {
+		t.Errorf("events %v, want only the back-channel logout event", claims.Events)
+	}
+}
+
+func TestBackchannelLogoutRetriesUntilFailed(t *testing.T) {
+	svc, db, _, receiver := newTestLogoutService(t, http.StatusServiceUnavailable)
+
+	before := time.Now()
+	svc.Notify([]model.Session{{UserID: 7, FamilyID: "family-1", ClientID: "app"}})
+	delivery := waitForDelivery(t, db, 1)
+
+	for attempts := 1; attempts < logoutMaxAttempts; attempts++ {
+		if delivery.Status != model.LogoutDeliveryPending || delivery.LastError != "unexpected status 503" {
+			t.Fatalf("attempt %d: delivery %+v, want pending with the error", attempts, delivery)
+		}
+		backoff := logoutRetryBackoff << (attempts - 1)
+		if delay := delivery.NextAttemptAt.Sub(before); delay < backoff || delay > backoff+5*time.Second {
+			t.Fatalf("attempt %d: retry in %v, want %v", attempts, delay, backoff)
+		}
+
+		// Nothing is sent before the backoff has elapsed
+		svc.DeliverDue()
+		if got := len(receiver.received()); got != attempts {
+			t.Fatalf("attempt %d: %d requests before the retry was due", attempts, got)
+		}
+
+		before = time.Now()
+		if err := db.Model(&delivery).Update("next_attempt_at", before).Error; err != nil {
+			t.Fatal(err)
+		}
+		svc.DeliverDue()
+		delivery = waitForDelivery(t, db, attempts+1)
+	}
+
+	if delivery.Status != model.LogoutDeliveryFailed || delivery.Attempts != logoutMaxAttempts {
+		t.Fatalf("delivery %+v, want failed after %d attempts", delivery, logoutMaxAttempts)
+	}
+	if err := db.Model(&delivery).Update("next_attempt_at", time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+	svc.DeliverDue()
+	if got := len(receiver.received()); got != logoutMaxAttempts {
+		t.Fatalf("%d requests, want no more than %d", got, logoutMaxAttempts)
+	}
+}
+
+func TestDeleteUserNotifiesClients(t *testing.T) {
+	svc, db, _, receiver := newTestLogoutService(t, http.StatusOK)
+	tokenStore := newTestTokenStore(t)
+	users := NewUserService(db, nil, NewSessionService(db, tokenStore, svc, newTestLogger()), newTestLogger())
+	user := createTestUser(t, db, "jane", "jane@example.com", "password123", "user")
+	session := model.Session{UserID: user.ID, FamilyID: "family-1", ClientID: "app", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := db.Create(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := users.DeleteUserByID(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	delivery := waitForDelivery(t, db, 1)
+	if delivery.UserID != user.ID || delivery.SessionID != "family-1" || delivery.Status != model.LogoutDeliveryDelivered {
+		t.Fatalf("unexpected delivery %+v", delivery)
+	}
+	if len(receiver.received()) != 1 {
+		t.Fatal("client not notified of the deleted user's session")
+	}
+	if err := db.First(&session, session.ID).Error; err != nil || session.RevokedAt == nil {
+		t.Fatalf("session of the deleted user not revoked (%v)", err)
+	}
+	if revoked, err := tokenStore.IsSessionRevoked("family-1"); err != nil || !revoked {
+		t.Fatal("access tokens of the deleted user's session still usable")
+	}
+}
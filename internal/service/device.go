@@ -0,0 +1,233 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+	deviceCodeTTL      = 10 * time.Minute
+	deviceCodeGrace    = 10 * time.Minute // Expired codes are kept this long to answer expired_token
+	devicePollInterval = 5 * time.Second
+	userCodeAlphabet   = "BCDFGHJKLMNPQRSTVWXZ" // No vowels or look-alike characters (RFC 8628 6.1)
+)
+
+// DeviceAuthorizationResponse is the RFC 8628 device authorization response.
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceRequest describes a pending device authorization to the approving user.
+type DeviceRequest struct {
+	UserCode   string `json:"user_code"`
+	ClientID   string `json:"client_id"`
+	ClientName string `json:"client_name"`
+	Scope      string `json:"scope"`
+}
+
+type DeviceService struct {
+	db              *database.Database
+	clients         *OAuthClientService
+	auth            *AuthService
+	grants          *GrantService
+	store           lib.DeviceCodeStore
+	verificationURI string
+	log             *logrus.Logger
+}
+
+func NewDeviceService(db *database.Database, clients *OAuthClientService, auth *AuthService, grants *GrantService, store lib.DeviceCodeStore, frontendURL string, log *logrus.Logger) *DeviceService {
+	return &DeviceService{db: db, clients: clients, auth: auth, grants: grants, store: store, verificationURI: frontendURL + "/device", log: log}
+}
+
+// Authorize starts a device authorization for the client and returns the codes to show on the device.
+func (s *DeviceService) Authorize(clientID, clientSecret, scope string) (*DeviceAuthorizationResponse, error) {
+	client, err := s.clients.Authenticate(clientID, clientSecret)
+	if err != nil {
+		return nil, oauthError("invalid_client", "Client authentication failed")
+	}
+	if !client.AllowsGrant(DeviceCodeGrantType) {
+		return nil, oauthError("unauthorized_client", "The device flow is not allowed for this client")
+	}
+	granted, oerr := grantedScope(client, scope)
+	if oerr != nil {
+		return nil, oerr
+	}
+
+	deviceCode, err := lib.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	userCode, err := newUserCode()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.Save(lib.HashToken(deviceCode), &lib.DeviceAuthorization{
+		ClientID:  client.ClientID,
+		Scope:     granted,
+		UserCode:  userCode,
+		Status:    lib.DeviceCodePending,
+		Interval:  devicePollInterval,
+		ExpiresAt: time.Now().Add(deviceCodeTTL),
+	}, deviceCodeTTL+deviceCodeGrace); err != nil {
+		return nil, err
+	}
+
+	return &DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         s.verificationURI,
+		VerificationURIComplete: s.verificationURI + "?user_code=" + url.QueryEscape(userCode),
+		ExpiresIn:               int(deviceCodeTTL.Seconds()),
+		Interval:                int(devicePollInterval.Seconds()),
+	}, nil
+}
+
+// Lookup returns the pending request for a user code so that the user can check what they approve.
+func (s *DeviceService) Lookup(userCode string) (*DeviceRequest, error) {
+	_, auth, err := s.findPending(userCode)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.clients.Get(auth.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceRequest{UserCode: auth.UserCode, ClientID: client.ClientID, ClientName: client.Name, Scope: auth.Scope}, nil
+}
+
+// Decide records the logged-in user's approval or denial of a user code.
+func (s *DeviceService) Decide(userID uint, userCode string, approve bool) error {
+	deviceCode, auth, err := s.findPending(userCode)
+	if err != nil {
+		return err
+	}
+	if approve {
+		auth.Status = lib.DeviceCodeApproved
+		auth.UserID = userID
+	} else {
+		auth.Status = lib.DeviceCodeDenied
+	}
+	if err := s.store.Update(deviceCode, auth); err != nil {
+		return err
+	}
+	if approve {
+		if err := s.grants.Record(userID, auth.ClientID, auth.Scope); err != nil {
+			return err
+		}
+	}
+	s.log.WithFields(logrus.Fields{"user_id": userID, "client_id": auth.ClientID, "status": auth.Status}).Info("Device authorization decided")
+	return nil
+}
+
+// Exchange answers a device's poll at the token endpoint.
+func (s *DeviceService) Exchange(client *model.OAuthClient, deviceCode string, info SessionInfo) (*TokenResponse, error) {
+	if deviceCode == "" {
+		return nil, oauthError("invalid_request", "device_code is required")
+	}
+	key := lib.HashToken(deviceCode)
+	auth, err := s.store.Get(key)
+	if errors.Is(err, lib.ErrDeviceCodeNotFound) {
+		return nil, oauthError("invalid_grant", "Invalid device code")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if auth.ClientID != client.ClientID {
+		return nil, oauthError("invalid_grant", "Device code was not issued to this client")
+	}
+	if time.Now().After(auth.ExpiresAt) {
+		return nil, oauthError("expired_token", "The device code has expired")
+	}
+
+	allowed, err := s.store.Throttle(key, auth.Interval)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		auth.Interval += devicePollInterval
+		if err := s.store.Update(key, auth); err != nil && !errors.Is(err, lib.ErrDeviceCodeNotFound) {
+			return nil, err
+		}
+		return nil, oauthError("slow_down", "Polling too fast, increase the interval by 5 seconds")
+	}
+
+	switch auth.Status {
+	case lib.DeviceCodePending:
+		return nil, oauthError("authorization_pending", "The user has not yet approved the request")
+	case lib.DeviceCodeDenied:
+		s.store.Take(key)
+		return nil, oauthError("access_denied", "The user denied the request")
+	}
+
+	// Approved: redeem exactly once even if the device polls concurrently
+	auth, err = s.store.Take(key)
+	if err != nil {
+		return nil, oauthError("invalid_grant", "Invalid device code")
+	}
+	var user model.User
+	if err := s.db.Preload("Role").Where("id = ?", auth.UserID).First(&user).Error; err != nil {
+		return nil, oauthError("invalid_grant", "User not found")
+	}
+
+	info.ClientID = client.ClientID
+	info.Scope = auth.Scope
+	if info.DeviceName == "" {
+		info.DeviceName = client.Name
+	}
+	tokens, err := s.auth.StartOAuthSession(&user, info, "")
+	if err != nil {
+		return nil, err
+	}
+	s.log.WithFields(logrus.Fields{"user_id": user.ID, "client_id": client.ClientID}).Info("Device code exchanged")
+	return tokenResponse(tokens, auth.Scope), nil
+}
+
+func (s *DeviceService) findPending(userCode string) (string, *lib.DeviceAuthorization, error) {
+	deviceCode, auth, err := s.store.FindByUserCode(normalizeUserCode(userCode))
+	if err != nil {
+		return "", nil, err
+	}
+	if auth.Status != lib.DeviceCodePending || time.Now().After(auth.ExpiresAt) {
+		return "", nil, lib.ErrDeviceCodeNotFound
+	}
+	return deviceCode, auth, nil
+}
+
+// newUserCode returns a code like "WDJB-MJHT" that is easy to type on another device.
+func newUserCode() (string, error) {
+	code := make([]byte, 8)
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code[:4]) + "-" + string(code[4:]), nil
+}
+
+// normalizeUserCode accepts user input in any case and with or without the dash.
+func normalizeUserCode(input string) string {
+	code := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(input))
+	if len(code) != 8 {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
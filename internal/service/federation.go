@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/shahariaz/gin-auth-service/internal/config"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+const (
+	federatedLoginCeremony = "oidc_login"
+	federationTimeout      = 10 * time.Second
+	defaultFederatedRole   = "user"
+)
+
+// FederatedLoginTTL is how long the user has to complete a login at the provider.
+const FederatedLoginTTL = 10 * time.Minute
+
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+// ProviderInfo describes an identity provider offered on the login page.
+type ProviderInfo struct {
+	Name        string `json:"name" example:"google"`
+	DisplayName string `json:"display_name" example:"Google"`
+}
+
+// federatedLogin is the state kept between the redirect to the provider and its callback.
+type federatedLogin struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	BindingHash  string `json:"binding_hash"` // Ties the callback to the browser that started the login
+	DeviceName   string `json:"device_name,omitempty"`
+	LinkUserID   uint   `json:"link_user_id,omitempty"` // Set when a signed-in user links the identity
+}
+
+// FederationResult is the outcome of a provider callback: either a principal to sign in, or the
+// identity that was linked to the account that started the flow.
+type FederationResult struct {
+	Principal  *Principal
+	DeviceName string
+	Linked     *model.Identity
+}
+
+// FederatedIdentity is what a provider asserted about the user after a successful callback.
+type FederatedIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	NoEmailLink   bool // Never link to an existing account by email, even a verified one
+}
+
+// federatedProvider is a configured provider whose discovery document is fetched on first use,
+// so that an unreachable provider does not prevent the service from starting.
+type federatedProvider struct {
+	config   config.OIDCProvider
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// FederationService signs users in with external OpenID Connect providers (relying party).
+type FederationService struct {
+	identities   *IdentityService
+	providers    map[string]*federatedProvider
+	order        []string
+	ceremonies   lib.CeremonyStore
+	callbackBase string
+	httpClient   *http.Client
+	log          *logrus.Logger
+}
+
+// NewFederationService configures the providers. Their redirect URI is
+// <issuer>/login/oidc/<name>/callback.
+func NewFederationService(providers []config.OIDCProvider, identities *IdentityService, ceremonies lib.CeremonyStore, issuer string, log *logrus.Logger) *FederationService {
+	s := &FederationService{
+		identities:   identities,
+		providers:    make(map[string]*federatedProvider, len(providers)),
+		ceremonies:   ceremonies,
+		callbackBase: issuer + "/login/oidc/",
+		httpClient:   &http.Client{Timeout: federationTimeout},
+		log:          log,
+	}
+	for _, provider := range providers {
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+		}
+		if provider.DisplayName == "" {
+			provider.DisplayName = provider.Name
+		}
+		s.providers[provider.Name] = &federatedProvider{config: provider}
+		s.order = append(s.order, provider.Name)
+	}
+	return s
+}
+
+// Providers lists the configured providers in configuration order.
+func (s *FederationService) Providers() []ProviderInfo {
+	providers := make([]ProviderInfo, 0, len(s.order))
+	for _, name := range s.order {
+		providers = append(providers, ProviderInfo{Name: name, DisplayName: s.providers[name].config.DisplayName})
+	}
+	return providers
+}
+
+// Begin starts a login with the provider and returns the authorization URL to redirect the
+// browser to. binding is a secret kept by the browser (cookie) and checked on the callback.
+func (s *FederationService) Begin(providerName, binding, deviceName string) (string, error) {
+	return s.begin(providerName, binding, federatedLogin{DeviceName: deviceName})
+}
+
+// BeginLink starts linking an identity at the provider to the signed-in user's account. The
+// callback is the same as for logins.
+func (s *FederationService) BeginLink(userID uint, providerName, binding string) (string, error) {
+	return s.begin(providerName, binding, federatedLogin{LinkUserID: userID})
+}
+
+func (s *FederationService) begin(providerName, binding string, login federatedLogin) (string, error) {
+	provider, oauthConfig, err := s.client(providerName)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := lib.NewTokenID()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := lib.NewTokenID()
+	if err != nil {
+		return "", err
+	}
+	login.Provider = provider.config.Name
+	login.Nonce = nonce
+	login.CodeVerifier = oauth2.GenerateVerifier()
+	login.BindingHash = lib.HashToken(binding)
+	if err := s.ceremonies.Save(federatedLoginCeremony, state, login, FederatedLoginTTL); err != nil {
+		return "", err
+	}
+	return oauthConfig.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(login.CodeVerifier)), nil
+}
+
+// complete handles the provider's callback: it exchanges the code, validates the ID token
+// against the provider's keys and returns the asserted identity with the pending login.
+func (s *FederationService) complete(providerName, state, code, binding string) (*FederatedIdentity, *federatedLogin, error) {
+	var login federatedLogin
+	if err := s.ceremonies.Take(federatedLoginCeremony, state, &login); err != nil {
+		return nil, nil, errors.New("unknown or expired login state")
+	}
+	if login.Provider != providerName || lib.HashToken(binding) != login.BindingHash {
+		return nil, nil, errors.New("login was started from another browser")
+	}
+
+	provider, oauthConfig, err := s.client(providerName)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(oidc.ClientContext(context.Background(), s.httpClient), federationTimeout)
+	defer cancel()
+
+	token, err := oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(login.CodeVerifier))
+	if err != nil {
+		return nil, nil, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, nil, errors.New("provider did not return an ID token")
+	}
+	idToken, err := provider.provider.Verifier(&oidc.Config{ClientID: provider.config.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if idToken.Nonce != login.Nonce {
+		return nil, nil, errors.New("ID token nonce mismatch")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, nil, err
+	}
+	identity := provider.identity(idToken.Subject, claims)
+	return identity, &login, nil
+}
+
+// Complete finishes a federated login and returns the signed-in user, creating or linking
+// the account on first use, along with the device name given when the login started. For a
+// flow started with BeginLink it returns the linked identity instead.
+func (s *FederationService) Complete(providerName, state, code, binding string) (*FederationResult, error) {
+	identity, login, err := s.complete(providerName, state, code, binding)
+	if err != nil {
+		return nil, err
+	}
+	if login.LinkUserID != 0 {
+		linked, err := s.identities.Link(login.LinkUserID, identity)
+		if err != nil {
+			return nil, err
+		}
+		return &FederationResult{Linked: linked}, nil
+	}
+
+	user, err := s.identities.Resolve(identity, defaultFederatedRole)
+	if err != nil {
+		return nil, err
+	}
+	s.log.WithFields(logrus.Fields{"user_id": user.ID, "provider": identity.Provider}).Info("Federated login")
+	return &FederationResult{Principal: &Principal{User: user, Method: MethodOIDC}, DeviceName: login.DeviceName}, nil
+}
+
+// client returns the provider, discovering it on first use, and its OAuth 2.0 configuration.
+func (s *FederationService) client(name string) (*federatedProvider, *oauth2.Config, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, nil, ErrUnknownProvider
+	}
+
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	if provider.provider == nil {
+		ctx, cancel := context.WithTimeout(oidc.ClientContext(context.Background(), s.httpClient), federationTimeout)
+		defer cancel()
+		discovered, err := oidc.NewProvider(ctx, provider.config.Issuer)
+		if err != nil {
+			return nil, nil, err
+		}
+		provider.provider = discovered
+	}
+	return provider, &oauth2.Config{
+		ClientID:     provider.config.ClientID,
+		ClientSecret: provider.config.ClientSecret,
+		Endpoint:     provider.provider.Endpoint(),
+		RedirectURL:  s.callbackBase + provider.config.Name + "/callback",
+		Scopes:       provider.config.Scopes,
+	}, nil
+}
+
+// identity maps the ID token claims with the provider's claim mapping.
+func (p *federatedProvider) identity(subject string, claims map[string]interface{}) *FederatedIdentity {
+	claim := func(name, fallback string) interface{} {
+		if mapped, ok := p.config.Claims[name]; ok {
+			return claims[mapped]
+		}
+		return claims[fallback]
+	}
+	email, _ := claim("email", "email").(string)
+	username, _ := claim("username", "preferred_username").(string)
+
+	var verified bool
+	switch value := claim("email_verified", "email_verified").(type) {
+	case bool:
+		verified = value
+	case string: // Some providers send "true"
+		verified = value == "true"
+	}
+	return &FederatedIdentity{
+		Provider:      p.config.Name,
+		Subject:       subject,
+		Email:         strings.ToLower(strings.TrimSpace(email)),
+		EmailVerified: verified,
+		Username:      username,
+	}
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/shahariaz/gin-auth-service/internal/config"
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+)
+
+// testProvider is an OpenID provider serving discovery, JWKS and a token endpoint that issues
+// ID tokens for the authorization requests it has seen.
+type testProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	keys   *lib.KeySet
+
+	mu     sync.Mutex
+	logins map[string]providerLogin // By authorization code
+}
+
+type providerLogin struct {
+	nonce         string
+	codeChallenge string
+	claims        jwt.MapClaims
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := lib.NewSigningKey("idp-key", private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProvider{t: t, keys: lib.NewKeySet(key), logins: map[string]providerLogin{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(p.keys.JWKS())
+	})
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// authorize plays the user signing in at the provider: it accepts the authorization URL the
+// service redirected to and returns the state and code the callback receives.
+func (p *testProvider) authorize(authURL string, claims jwt.MapClaims) (state, code string) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		p.t.Fatal("authorization request without PKCE")
+	}
+	code = "code-" + query.Get("state")
+	p.mu.Lock()
+	p.logins[code] = providerLogin{nonce: query.Get("nonce"), codeChallenge: query.Get("code_challenge"), claims: claims}
+	p.mu.Unlock()
+	return query.Get("state"), code
+}
+
+func (p *testProvider) token(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	login, ok := p.logins[r.PostFormValue("code")]
+	delete(p.logins, r.PostFormValue("code"))
+	p.mu.Unlock()
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != login.codeChallenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   p.server.URL,
+		"aud":   "rp-client",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": login.nonce,
+	}
+	for name, value := range login.claims {
+		claims[name] = value
+	}
+	idToken, err := p.keys.Sign(claims)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "provider-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+func newTestFederationService(t *testing.T) (*FederationService, *testProvider, *database.Database) {
+	t.Helper()
+	db := newTestDB(t)
+	provider := newTestProvider(t)
+	log := newTestLogger()
+	svc := NewFederationService([]config.OIDCProvider{{
+		Name:         "acme",
+		Issuer:       provider.server.URL,
+		ClientID:     "rp-client",
+		ClientSecret: "rp-secret",
+	}}, NewIdentityService(db, log), newTestCeremonyStore(t), testIssuer, log)
+	return svc, provider, db
+}
+
+// federatedLoginWith runs a login with the provider asserting claims and returns the callback result.
+func federatedLoginWith(t *testing.T, svc *FederationService, provider *testProvider, claims jwt.MapClaims) (*FederationResult, error) {
+	t.Helper()
+	authURL, err := svc.Begin("acme", "browser-binding", "Laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := provider.authorize(authURL, claims)
+	return svc.Complete("acme", state, code, "browser-binding")
+}
+
+func TestFederatedLoginProvisionsUser(t *testing.T) {
+	svc, provider, db := newTestFederationService(t)
+	claims := jwt.MapClaims{"sub": "acme-123", "email": "New.User@Example.com", "email_verified": true, "preferred_username": "newuser"}
+
+	result, err := federatedLoginWith(t, svc, provider, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := result.Principal.User
+	if result.Principal.Method != MethodOIDC || result.DeviceName != "Laptop" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if user.Email != "new.user@example.com" || user.Username != "newuser" || user.Role.Name != "user" || user.EmailVerifiedAt == nil || user.Password != "" {
+		t.Fatalf("unexpected provisioned user %+v", user)
+	}
+	var identity model.Identity
+	if err := db.Where("provider = ? AND subject = ?", "acme", "acme-123").First(&identity).Error; err != nil {
+		t.Fatal(err)
+	}
+	if identity.UserID != user.ID {
+		t.Fatalf("identity linked to user %d, want %d", identity.UserID, user.ID)
+	}
+
+	// The next login finds the same account through the identity
+	result, err = federatedLoginWith(t, svc, provider, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Principal.User.ID != user.ID {
+		t.Fatalf("second login signed in user %d, want %d", result.Principal.User.ID, user.ID)
+	}
+	var count int64
+	db.Model(&model.User{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("%d users after two logins, want 1", count)
+	}
+}
+
+func TestFederatedLoginRefusesUnverifiedEmailOfExistingAccount(t *testing.T) {
+	svc, provider, db := newTestFederationService(t)
+	createTestUser(t, db, "jane", "jane@example.com", "password123", "admin")
+
+	_, err := federatedLoginWith(t, svc, provider, jwt.MapClaims{"sub": "acme-123", "email": "jane@example.com", "email_verified": false})
+	if !errors.Is(err, ErrIdentityConflict) {
+		t.Fatalf("got %v, want ErrIdentityConflict", err)
+	}
+	var count int64
+	db.Model(&model.Identity{}).Count(&count)
+	if count != 0 {
+		t.Fatal("identity linked to the existing account")
+	}
+}
+
+func TestFederatedLoginRejectsStateMismatch(t *testing.T) {
+	svc, provider, _ := newTestFederationService(t)
+	claims := jwt.MapClaims{"sub": "acme-123", "email": "jane@example.com", "email_verified": true}
+
+	authURL, err := svc.Begin("acme", "browser-binding", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, code := provider.authorize(authURL, claims)
+	if _, err := svc.Complete("acme", "forged-state", code, "browser-binding"); err == nil {
+		t.Fatal("callback accepted an unknown state")
+	}
+
+	authURL, err = svc.Begin("acme", "browser-binding", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := provider.authorize(authURL, claims)
+	if _, err := svc.Complete("acme", state, code, "other-browser"); err == nil {
+		t.Fatal("callback accepted a login started from another browser")
+	}
+	// The state is single use, even after a failed callback
+	if _, err := svc.Complete("acme", state, code, "browser-binding"); err == nil {
+		t.Fatal("callback accepted a state twice")
+	}
+}
+
+func TestFederatedLoginRejectsNonceMismatch(t *testing.T) {
+	svc, provider, db := newTestFederationService(t)
+
+	_, err := federatedLoginWith(t, svc, provider, jwt.MapClaims{"sub": "acme-123", "email": "jane@example.com", "email_verified": true, "nonce": "replayed-nonce"})
+	if err == nil {
+		t.Fatal("callback accepted an ID token with another nonce")
+	}
+	var count int64
+	db.Model(&model.User{}).Count(&count)
+	if count != 0 {
+		t.Fatal("user provisioned despite the nonce mismatch")
+	}
+}
+
+func TestFederatedLoginRejectsTokenFromAnotherIssuer(t *testing.T) {
+	svc, provider, _ := newTestFederationService(t)
+
+	_, err := federatedLoginWith(t, svc, provider, jwt.MapClaims{"sub": "acme-123", "email": "jane@example.com", "email_verified": true, "iss": "https://evil.example.com"})
+	if err == nil {
+		t.Fatal("callback accepted an ID token from another issuer")
+	}
+}
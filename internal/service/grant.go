@@ -0,0 +1,103 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type GrantService struct {
+	db       *database.Database
+	sessions *SessionService
+	log      *logrus.Logger
+}
+
+func NewGrantService(db *database.Database, sessions *SessionService, log *logrus.Logger) *GrantService {
+	return &GrantService{db: db, sessions: sessions, log: log}
+}
+
+// Covers reports whether the user has already granted every scope in scope to the client.
+func (s *GrantService) Covers(userID uint, clientID, scope string) (bool, error) {
+	var grant model.OAuthGrant
+	err := s.db.Where("user_id = ? AND client_id = ?", userID, clientID).First(&grant).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !widens(grant.Scope, scope), nil
+}
+
+// Record adds scope to the user's grant for the client, creating the grant if needed.
+func (s *GrantService) Record(userID uint, clientID, scope string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var grant model.OAuthGrant
+		err := tx.Where("user_id = ? AND client_id = ?", userID, clientID).First(&grant).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Create(&model.OAuthGrant{UserID: userID, ClientID: clientID, Scope: scope}).Error
+		}
+		if err != nil {
+			return err
+		}
+		if !widens(grant.Scope, scope) {
+			return nil
+		}
+		scopes := strings.Fields(grant.Scope)
+		for _, value := range strings.Fields(scope) {
+			if !hasScope(grant.Scope, value) {
+				scopes = append(scopes, value)
+			}
+		}
+		return tx.Model(&grant).Update("scope", strings.Join(scopes, " ")).Error
+	})
+}
+
+// List returns the user's grants with the name of each client.
+func (s *GrantService) List(userID uint) ([]model.OAuthGrant, error) {
+	var grants []model.OAuthGrant
+	if err := s.db.Where("user_id = ?", userID).Order("updated_at DESC").Find(&grants).Error; err != nil {
+		return nil, err
+	}
+	if len(grants) == 0 {
+		return grants, nil
+	}
+
+	clientIDs := make([]string, 0, len(grants))
+	for _, grant := range grants {
+		clientIDs = append(clientIDs, grant.ClientID)
+	}
+	var clients []model.OAuthClient
+	if err := s.db.Where("client_id IN ?", clientIDs).Find(&clients).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(clients))
+	for _, client := range clients {
+		names[client.ClientID] = client.Name
+	}
+	for i := range grants {
+		grants[i].ClientName = names[grants[i].ClientID]
+	}
+	return grants, nil
+}
+
+// Revoke withdraws the user's consent for the client and ends every session the client holds
+// for the user, so that its refresh tokens stop working.
+func (s *GrantService) Revoke(userID uint, clientID string) (int, error) {
+	result := s.db.Where("user_id = ? AND client_id = ?", userID, clientID).Delete(&model.OAuthGrant{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	count, err := s.sessions.RevokeClient(userID, clientID)
+	if err != nil {
+		return 0, err
+	}
+	if result.RowsAffected == 0 && count == 0 {
+		return 0, errors.New("grant not found")
+	}
+	return count, nil
+}
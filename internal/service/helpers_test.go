@@ -0,0 +1,121 @@
+package service
+
+import (
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-playground/validator/v10"
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/mail"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testIssuer = "https://auth.example.com"
+
+func newTestLogger() *logrus.Logger {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	return log
+}
+
+// newTestDB returns a migrated SQLite database that lives for the duration of the test.
+func newTestDB(t *testing.T) *database.Database {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=5000&_foreign_keys=off"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	wrapped := &database.Database{DB: db}
+	if err := database.RunMigrations(wrapped, newTestLogger()); err != nil {
+		t.Fatal(err)
+	}
+	return wrapped
+}
+
+// newTestAuthService returns an AuthService with a fresh key set, logging users in through the
+// given authenticators.
+func newTestAuthService(t *testing.T, db *database.Database, authenticators ...Authenticator) (*AuthService, *lib.KeySet) {
+	t.Helper()
+	log := newTestLogger()
+	keys, err := lib.NewEphemeralKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("test-secret")
+	tokenStore := newTestTokenStore(t)
+	sessions := NewSessionService(db, tokenStore, NewBackchannelLogoutService(db, keys, testIssuer, log), log)
+	verification := NewVerificationService(db, tokenStore, &testMailer{}, "https://app.example.com", false, testIssuer, secret, log)
+	auth := NewAuthService(db, validator.New(), tokenStore, sessions, NewMFAService(db, "Test", log), verification, authenticators, keys, testIssuer, "frontend", secret, log)
+	return auth, keys
+}
+
+func newTestTokenStore(t *testing.T) lib.TokenStore {
+	t.Helper()
+	store, err := lib.NewRedisTokenStore(miniredis.RunT(t).Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func newTestCeremonyStore(t *testing.T) lib.CeremonyStore {
+	t.Helper()
+	store, err := lib.NewRedisCeremonyStore(miniredis.RunT(t).Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// createTestUser creates a verified user with the given role; an empty password creates an
+// account without one.
+func createTestUser(t *testing.T, db *database.Database, username, email, password, roleName string) *model.User {
+	t.Helper()
+	var role model.Role
+	if err := db.Where("name = ?", roleName).First(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	user := model.User{Username: username, Email: email, RoleID: role.ID, EmailVerifiedAt: &now}
+	if password != "" {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		user.Password = string(hashed)
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	user.Role = role
+	return &user
+}
+
+// testMailer records the emails it is asked to send.
+type testMailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (m *testMailer) Send(msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrIdentityNotFound  = errors.New("identity not found")
+	ErrIdentityConflict  = errors.New("an account with this email already exists; sign in to it and link this provider from your profile")
+	ErrIdentityLinked    = errors.New("this identity is already linked to another account")
+	ErrLastLoginMethod   = errors.New("this is the last way to sign in to the account; set a password or add another login method first")
+	ErrIdentityManaged   = errors.New("the account is managed by the directory; its directory identity cannot be unlinked")
+	usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+)
+
+// LoginMethods lists every way a user can sign in.
+type LoginMethods struct {
+	Password   bool                      `json:"password" example:"true"`
+	Identities []model.Identity          `json:"identities"`
+	Passkeys   []model.PasskeyCredential `json:"passkeys"`
+}
+
+// IdentityService manages the login methods linked to an account and maps external identities
+// to users. Linking an identity starts at its provider (FederationService.BeginLink).
+type IdentityService struct {
+	db  *database.Database
+	log *logrus.Logger
+}
+
+func NewIdentityService(db *database.Database, log *logrus.Logger) *IdentityService {
+	return &IdentityService{db: db, log: log}
+}
+
+func (s *IdentityService) List(userID uint) (*LoginMethods, error) {
+	var user model.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	methods := LoginMethods{Password: user.Password != ""}
+	if err := s.db.Where("user_id = ?", userID).Order("linked_at").Find(&methods.Identities).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Where("user_id = ?", userID).Order("created_at").Find(&methods.Passkeys).Error; err != nil {
+		return nil, err
+	}
+	return &methods, nil
+}
+
+// Unlink removes an external identity unless it is the user's last login method. Directory
+// identities stay linked for as long as the account exists.
+func (s *IdentityService) Unlink(userID, id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var identity model.Identity
+		if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&identity).Error; err != nil {
+			return ErrIdentityNotFound
+		}
+		if identity.Provider == ldapProvider {
+			return ErrIdentityManaged
+		}
+		if err := ensureOtherLoginMethod(tx, userID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&identity).Error; err != nil {
+			return err
+		}
+		s.log.WithFields(logrus.Fields{"user_id": userID, "provider": identity.Provider}).Info("Identity unlinked")
+		return nil
+	})
+}
+
+// Link attaches an external identity to the user's account. Linking an identity the user
+// already has is a no-op; one that belongs to another account is refused.
+func (s *IdentityService) Link(userID uint, identity *FederatedIdentity) (*model.Identity, error) {
+	var linked model.Identity
+	err := s.db.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&linked).Error
+	if err == nil {
+		if linked.UserID != userID {
+			return nil, ErrIdentityLinked
+		}
+		return &linked, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	linked = model.Identity{
+		UserID:   userID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+	if err := s.db.Create(&linked).Error; err != nil {
+		return nil, err
+	}
+	s.log.WithFields(logrus.Fields{"user_id": userID, "provider": identity.Provider}).Info("Identity linked")
+	return &linked, nil
+}
+
+// Resolve finds the user behind an external identity at login. Unknown identities are linked
+// to the account with the same email if both the provider and this service verified it and the
+// identity allows it, else a new account with the given role is created (just-in-time
+// provisioning).
+func (s *IdentityService) Resolve(identity *FederatedIdentity, role string) (*model.User, error) {
+	now := time.Now()
+	var user model.User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var existing model.Identity
+		err := tx.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&existing).Error
+		if err == nil {
+			if err := tx.Model(&existing).Update("last_login_at", now).Error; err != nil {
+				return err
+			}
+			return tx.Preload("Role").Where("id = ?", existing.UserID).First(&user).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if identity.Email == "" {
+			return errors.New("provider did not return an email address")
+		}
+		err = tx.Preload("Role").Where("email = ?", identity.Email).First(&user).Error
+		switch {
+		case err == nil && (!identity.EmailVerified || identity.NoEmailLink || user.EmailVerifiedAt == nil):
+			return ErrIdentityConflict
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := s.createUser(tx, identity, role, &user); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		}
+
+		return tx.Create(&model.Identity{
+			UserID:      user.ID,
+			Provider:    identity.Provider,
+			Subject:     identity.Subject,
+			Email:       identity.Email,
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// createUser provisions an account for a first-time federated login. It has no password; the
+// user can set one with the password reset flow.
+func (s *IdentityService) createUser(tx *gorm.DB, identity *FederatedIdentity, roleName string, user *model.User) error {
+	var role model.Role
+	if err := tx.Where("name = ?", roleName).First(&role).Error; err != nil {
+		return fmt.Errorf("role %q: %w", roleName, err)
+	}
+	username, err := availableUsername(tx, identity)
+	if err != nil {
+		return err
+	}
+
+	*user = model.User{
+		Username: username,
+		Email:    identity.Email,
+		RoleID:   role.ID,
+		Role:     role,
+	}
+	if identity.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	if err := tx.Omit("Role").Create(user).Error; err != nil {
+		return err
+	}
+	s.log.WithFields(logrus.Fields{"user_id": user.ID, "provider": identity.Provider}).Info("User created from federated login")
+	return nil
+}
+
+// availableUsername derives an unused username from the identity's username or email.
+func availableUsername(tx *gorm.DB, identity *FederatedIdentity) (string, error) {
+	base := identity.Username
+	if base == "" {
+		base = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+	base = usernameInvalidChars.ReplaceAllString(base, "")
+	if len(base) < 3 {
+		base = "user"
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	username := base
+	for i := 0; i < 5; i++ {
+		var count int64
+		if err := tx.Model(&model.User{}).Unscoped().Where("username = ?", username).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return username, nil
+		}
+		suffix, err := lib.NewTokenID()
+		if err != nil {
+			return "", err
+		}
+		username = base + "_" + suffix[:6]
+	}
+	return "", errors.New("could not find a free username")
+}
+
+// ensureOtherLoginMethod returns ErrLastLoginMethod unless the user has at least two login
+// methods, so that one of them can be removed. The user row is locked for the rest of the
+// transaction so that concurrent removals cannot both pass the check.
+func ensureOtherLoginMethod(tx *gorm.DB, userID uint) error {
+	var user model.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+	var identities, passkeys int64
+	if err := tx.Model(&model.Identity{}).Where("user_id = ?", userID).Count(&identities).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&model.PasskeyCredential{}).Where("user_id = ?", userID).Count(&passkeys).Error; err != nil {
+		return err
+	}
+	methods := identities + passkeys
+	if user.Password != "" {
+		methods++
+	}
+	if methods < 2 {
+		return ErrLastLoginMethod
+	}
+	return nil
+}
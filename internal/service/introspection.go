@@ -0,0 +1,128 @@
+package service
+
+import (
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+)
+
+// IntrospectionResponse is the RFC 7662 introspection response. Inactive tokens only carry
+// active=false, whatever the reason.
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Sub       string   `json:"sub,omitempty"`
+	Aud       []string `json:"aud,omitempty"`
+	Iss       string   `json:"iss,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+}
+
+// Introspect reports whether a token is active. Any confidential client (typically a resource
+// server) may introspect access tokens; refresh tokens are only described to the client they
+// were issued to.
+func (s *OAuthService) Introspect(clientID, clientSecret, token, hint string) (*IntrospectionResponse, error) {
+	client, err := s.clients.Authenticate(clientID, clientSecret)
+	if err != nil || !client.IsConfidential() {
+		return nil, oauthError("invalid_client", "Client authentication failed")
+	}
+
+	access := func() *IntrospectionResponse { return s.introspectAccessToken(token) }
+	refresh := func() *IntrospectionResponse { return s.introspectRefreshToken(client, token) }
+	first, second := access, refresh
+	if hint == "refresh_token" {
+		first, second = refresh, access
+	}
+	if response := first(); response != nil {
+		return response, nil
+	}
+	if response := second(); response != nil {
+		return response, nil
+	}
+	return &IntrospectionResponse{Active: false}, nil
+}
+
+// Revoke revokes an access or refresh token issued to the client (RFC 7009). Unknown or
+// already invalid tokens are not an error.
+func (s *OAuthService) Revoke(clientID, clientSecret, token, hint string) error {
+	client, err := s.clients.Authenticate(clientID, clientSecret)
+	if err != nil {
+		return oauthError("invalid_client", "Client authentication failed")
+	}
+
+	revokeRefresh := func() (bool, error) {
+		_, session, err := s.auth.ActiveRefreshToken(token)
+		if err != nil {
+			return false, nil
+		}
+		if session.ClientID != client.ClientID {
+			return true, oauthError("unauthorized_client", "Token was not issued to this client")
+		}
+		s.log.WithFields(logrus.Fields{"client_id": client.ClientID, "user_id": session.UserID}).Info("Refresh token revoked")
+		return true, s.auth.Logout(token)
+	}
+	revokeAccess := func() (bool, error) {
+		claims, err := s.auth.ActiveAccessToken(token)
+		if err != nil {
+			return false, nil
+		}
+		if claims.ClientID != client.ClientID {
+			return true, oauthError("unauthorized_client", "Token was not issued to this client")
+		}
+		s.log.WithFields(logrus.Fields{"client_id": client.ClientID, "user_id": claims.UserID}).Info("Access token revoked")
+		return true, s.auth.RevokeAccessToken(token, claims)
+	}
+
+	first, second := revokeAccess, revokeRefresh
+	if hint == "refresh_token" {
+		first, second = revokeRefresh, revokeAccess
+	}
+	if done, err := first(); done {
+		return err
+	}
+	_, err = second()
+	return err
+}
+
+func (s *OAuthService) introspectAccessToken(token string) *IntrospectionResponse {
+	claims, err := s.auth.ActiveAccessToken(token)
+	if err != nil {
+		return nil
+	}
+	return &IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Username:  claims.Username,
+		TokenType: "access_token",
+		Exp:       claims.ExpiresAt.Unix(),
+		Iat:       claims.IssuedAt.Unix(),
+		Sub:       claims.Subject,
+		Aud:       claims.Audience,
+		Iss:       claims.Issuer,
+		SessionID: claims.SessionID,
+	}
+}
+
+func (s *OAuthService) introspectRefreshToken(client *model.OAuthClient, token string) *IntrospectionResponse {
+	claims, session, err := s.auth.ActiveRefreshToken(token)
+	if err != nil || session.ClientID != client.ClientID {
+		return nil
+	}
+	return &IntrospectionResponse{
+		Active:    true,
+		Scope:     session.Scope,
+		ClientID:  session.ClientID,
+		Username:  claims.Username,
+		TokenType: "refresh_token",
+		Exp:       claims.ExpiresAt.Unix(),
+		Iat:       claims.IssuedAt.Unix(),
+		Sub:       lib.Subject(claims.UserID),
+		Iss:       claims.Issuer,
+		SessionID: claims.FamilyID,
+	}
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+)
+
+func TestIntrospectAndRevokeExchangedToken(t *testing.T) {
+	db := newTestDB(t)
+	log := newTestLogger()
+	auth, keys := newTestAuthService(t, db)
+	clients := NewOAuthClientService(db, "", log)
+	oauth := NewOAuthService(db, clients, auth, nil, nil, newTestCeremonyStore(t), log)
+
+	gateway, gatewaySecret, err := clients.Create(ClientRegistration{
+		Name:             "Gateway",
+		Type:             model.OAuthClientConfidential,
+		AllowedScopes:    []string{"orders:read"},
+		GrantTypes:       []string{TokenExchangeGrantType},
+		AllowedAudiences: []string{"billing-api"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	billing, billingSecret, err := clients.Create(ClientRegistration{
+		Name:       "Billing",
+		Type:       model.OAuthClientConfidential,
+		GrantTypes: []string{"client_credentials"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subjectToken, err := lib.GenerateAccessToken(7, "jane", "user", lib.Grant{SessionID: "s1"}, testIssuer, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchanged, err := oauth.Token(TokenRequest{
+		GrantType:        TokenExchangeGrantType,
+		ClientID:         gateway.ClientID,
+		ClientSecret:     gatewaySecret,
+		SubjectToken:     subjectToken,
+		SubjectTokenType: AccessTokenType,
+		Audience:         "billing-api",
+		Scope:            "orders:read",
+	}, SessionInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lib.ParseAccessToken(exchanged.AccessToken, testIssuer, keys); err == nil {
+		t.Fatal("exchanged token is accepted by the API")
+	}
+
+	response, err := oauth.Introspect(billing.ClientID, billingSecret, exchanged.AccessToken, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !response.Active || response.Sub != lib.Subject(7) || response.ClientID != gateway.ClientID || response.Scope != "orders:read" {
+		t.Fatalf("unexpected introspection response %+v", response)
+	}
+	if len(response.Aud) != 1 || response.Aud[0] != "billing-api" {
+		t.Fatalf("audience %v, want billing-api", response.Aud)
+	}
+
+	if err := oauth.Revoke(billing.ClientID, billingSecret, exchanged.AccessToken, ""); err == nil {
+		t.Fatal("a client revoked a token it was not issued")
+	}
+	if err := oauth.Revoke(gateway.ClientID, gatewaySecret, exchanged.AccessToken, ""); err != nil {
+		t.Fatal(err)
+	}
+	response, err = oauth.Introspect(billing.ClientID, billingSecret, exchanged.AccessToken, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Active {
+		t.Fatal("revoked exchanged token is still active")
+	}
+}
+
+func TestIntrospectRejectsIDTokens(t *testing.T) {
+	_, keys := newTestAuthService(t, newTestDB(t))
+	idToken, err := keys.Sign(&lib.TokenClaims{UserID: 7, RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   lib.Subject(7),
+		Issuer:    testIssuer,
+		Audience:  []string{"frontend"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lib.ParseIssuedAccessToken(idToken, testIssuer, keys); err == nil {
+		t.Fatal("ID token accepted as an access token")
+	}
+}
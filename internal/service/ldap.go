@@ -0,0 +1,222 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/shahariaz/gin-auth-service/internal/config"
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ldapProvider = "ldap" // Provider of the identities linking accounts to directory entries
+	ldapTimeout  = 10 * time.Second
+)
+
+var errDirectoryUnavailable = errors.New("no directory server is reachable")
+
+// LDAPService authenticates users against an LDAP or Active Directory server by binding with
+// their directory password, and keeps the local account in sync with the directory entry.
+type LDAPService struct {
+	config     config.LDAPConfig
+	rootCAs    *x509.CertPool
+	identities *IdentityService
+	db         *database.Database
+	log        *logrus.Logger
+}
+
+// NewLDAPService configures the directory. rootCAs verifies the servers' certificates; nil uses
+// the system roots.
+func NewLDAPService(cfg config.LDAPConfig, rootCAs *x509.CertPool, identities *IdentityService, db *database.Database, log *logrus.Logger) *LDAPService {
+	return &LDAPService{config: cfg, rootCAs: rootCAs, identities: identities, db: db, log: log}
+}
+
+func (s *LDAPService) Enabled() bool {
+	return s.config.Enabled()
+}
+
+func (s *LDAPService) Name() string {
+	return MethodLDAP
+}
+
+// Authenticate finds the directory entry for the login (email or username, see the user
+// filter), binds as it with the password and returns the local account, creating it on first
+// login. Logins without an entry are passed on, as are all logins while no server is
+// reachable: local passwords keep working, and directory accounts are refused by the password
+// authenticator anyway.
+func (s *LDAPService) Authenticate(credentials Credentials) (*Principal, error) {
+	if credentials.Password == "" {
+		// An empty password is an unauthenticated bind, which servers report as a success
+		return nil, errors.New("invalid password")
+	}
+	conn, err := s.connect()
+	if err != nil {
+		s.log.WithError(err).Error("LDAP authentication unavailable")
+		return nil, ErrPass
+	}
+	defer conn.Close()
+
+	entry, err := s.findUser(conn, credentials.Login)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Bind(entry.DN, credentials.Password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, errors.New("invalid password")
+		}
+		return nil, err
+	}
+	user, err := s.syncUser(entry)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{User: user, Method: MethodLDAP}, nil
+}
+
+// Manages reports whether the account is linked to a directory entry. Such accounts only sign
+// in with their directory password, so that disabling them in the directory takes effect.
+func (s *LDAPService) Manages(userID uint) (bool, error) {
+	var count int64
+	err := s.db.Model(&model.Identity{}).Where("user_id = ? AND provider = ?", userID, ldapProvider).Count(&count).Error
+	return count > 0, err
+}
+
+// connect returns a connection to the first reachable server, bound as the service account.
+func (s *LDAPService) connect() (*ldap.Conn, error) {
+	var lastErr error
+	for _, serverURL := range s.config.URLs {
+		conn, err := s.dial(serverURL)
+		if err == nil {
+			return conn, nil
+		}
+		s.log.WithError(err).WithField("url", serverURL).Warn("LDAP server unavailable")
+		lastErr = err
+	}
+	return nil, fmt.Errorf("%w: %v", errDirectoryUnavailable, lastErr)
+}
+
+func (s *LDAPService) dial(serverURL string) (*ldap.Conn, error) {
+	parsed, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{RootCAs: s.rootCAs, ServerName: parsed.Hostname(), MinVersion: tls.VersionTLS12}
+	conn, err := ldap.DialURL(serverURL, ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}), ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if s.config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if s.config.BindDN != "" {
+		if err := conn.Bind(s.config.BindDN, s.config.BindPassword); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (s *LDAPService) findUser(conn *ldap.Conn, login string) (*ldap.Entry, error) {
+	filter := strings.ReplaceAll(s.config.UserFilter, "{login}", ldap.EscapeFilter(login))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		s.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false, filter,
+		[]string{s.config.IDAttribute, s.config.EmailAttribute, s.config.UsernameAttribute, s.config.GroupAttribute}, nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, err
+	}
+	switch {
+	case len(result.Entries) == 0:
+		return nil, ErrPass
+	case len(result.Entries) > 1:
+		return nil, errors.New("login matches more than one directory entry")
+	}
+	return result.Entries[0], nil
+}
+
+// syncUser maps the entry to its local account, then updates the account's email and, when
+// groups are mapped to roles, its role from the entry. An entry is only linked to an existing
+// account with the same email when LinkExisting is set: syncing would otherwise let whoever
+// controls the directory entry take over the account, and its role.
+func (s *LDAPService) syncUser(entry *ldap.Entry) (*model.User, error) {
+	subject := entry.GetAttributeValue(s.config.IDAttribute)
+	if raw := entry.GetRawAttributeValue(s.config.IDAttribute); !utf8.Valid(raw) {
+		subject = hex.EncodeToString(raw) // objectGUID is binary
+	}
+	if subject == "" {
+		return nil, fmt.Errorf("directory entry has no %s attribute", s.config.IDAttribute)
+	}
+	identity := &FederatedIdentity{
+		Provider:      ldapProvider,
+		Subject:       subject,
+		Email:         strings.ToLower(strings.TrimSpace(entry.GetAttributeValue(s.config.EmailAttribute))),
+		EmailVerified: true, // Directory entries are managed by administrators
+		Username:      entry.GetAttributeValue(s.config.UsernameAttribute),
+		NoEmailLink:   !s.config.LinkExisting,
+	}
+	role := s.role(entry)
+	user, err := s.identities.Resolve(identity, role)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.config.GroupRoles) > 0 && user.Role.Name != role {
+		var mapped model.Role
+		if err := s.db.Where("name = ?", role).First(&mapped).Error; err != nil {
+			return nil, fmt.Errorf("role %q: %w", role, err)
+		}
+		if err := s.db.Model(user).Omit("Role").Update("role_id", mapped.ID).Error; err != nil {
+			return nil, err
+		}
+		user.RoleID, user.Role = mapped.ID, mapped
+		s.log.WithFields(logrus.Fields{"user_id": user.ID, "role": role}).Info("Role synced from directory")
+	}
+	if identity.Email != "" && user.Email != identity.Email {
+		if err := s.db.Model(user).Omit("Role").Update("email", identity.Email).Error; err != nil {
+			s.log.WithError(err).WithField("user_id", user.ID).Warn("Failed to sync email from directory")
+		} else {
+			user.Email = identity.Email
+		}
+	}
+	return user, nil
+}
+
+// role returns the role of the first mapped group the entry is a member of.
+func (s *LDAPService) role(entry *ldap.Entry) string {
+	groups := entry.GetAttributeValues(s.config.GroupAttribute)
+	for _, mapping := range s.config.GroupRoles {
+		for _, group := range groups {
+			if sameDN(group, mapping.Group) {
+				return mapping.Role
+			}
+		}
+	}
+	return s.config.DefaultRole
+}
+
+// sameDN compares DNs the way the directory does: ignoring case and insignificant spaces.
+func sameDN(a, b string) bool {
+	dnA, errA := ldap.ParseDN(a)
+	dnB, errB := ldap.ParseDN(b)
+	if errA != nil || errB != nil {
+		return strings.EqualFold(a, b)
+	}
+	return dnA.EqualFold(dnB)
+}
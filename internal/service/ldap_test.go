@@ -0,0 +1,380 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/shahariaz/gin-auth-service/internal/config"
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+)
+
+const (
+	testServiceDN       = "cn=auth-service,ou=services,dc=example,dc=com"
+	testServicePassword = "service-secret"
+)
+
+type directoryEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// testDirectory is an in-process LDAP server answering simple binds, searches on mail and uid,
+// and StartTLS.
+type testDirectory struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	rootCAs   *x509.CertPool
+
+	mu       sync.Mutex
+	entries  []directoryEntry
+	searches []string
+}
+
+func newTestDirectory(t *testing.T, entries ...directoryEntry) *testDirectory {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldap.test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(cert)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	d := &testDirectory{
+		listener:  listener,
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		rootCAs:   rootCAs,
+		entries:   entries,
+	}
+	go d.serve()
+	return d
+}
+
+func (d *testDirectory) URL() string {
+	return "ldap://" + d.listener.Addr().String()
+}
+
+func (d *testDirectory) setAttribute(dn, name string, values ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, entry := range d.entries {
+		if entry.dn == dn {
+			entry.attributes[name] = values
+		}
+	}
+}
+
+func (d *testDirectory) serve() {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return
+		}
+		go d.handle(conn)
+	}
+}
+
+func (d *testDirectory) handle(raw net.Conn) {
+	defer raw.Close()
+	var conn io.ReadWriter = raw
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			code := d.bind(op.Children[1].Value.(string), op.Children[2].Data.String())
+			conn.Write(ldapResult(id, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				conn.Write(ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultFilterError).Bytes())
+				continue
+			}
+			for _, entry := range d.search(filter) {
+				conn.Write(searchResultEntry(id, entry).Bytes())
+			}
+			conn.Write(ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		case ldap.ApplicationExtendedRequest: // StartTLS, the only extended operation the client sends
+			conn.Write(ldapResult(id, ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess).Bytes())
+			secure := tls.Server(raw, d.tlsConfig)
+			if err := secure.Handshake(); err != nil {
+				return
+			}
+			conn = secure
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func (d *testDirectory) bind(dn, password string) uint16 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if dn == testServiceDN && password == testServicePassword {
+		return ldap.LDAPResultSuccess
+	}
+	for _, entry := range d.entries {
+		if entry.dn == dn && entry.password == password {
+			return ldap.LDAPResultSuccess
+		}
+	}
+	return ldap.LDAPResultInvalidCredentials
+}
+
+// search matches the filter's equality assertions on mail and uid, ignoring case like the
+// directory does, which is enough for the default user filter.
+func (d *testDirectory) search(filter string) []directoryEntry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.searches = append(d.searches, filter)
+	var matches []directoryEntry
+	for _, entry := range d.entries {
+		for _, name := range []string{"mail", "uid"} {
+			for _, value := range entry.attributes[name] {
+				if strings.Contains(strings.ToLower(filter), strings.ToLower("("+name+"="+ldap.EscapeFilter(value)+")")) {
+					matches = append(matches, entry)
+				}
+			}
+		}
+	}
+	return matches
+}
+
+func ldapResult(id int64, tag ber.Tag, code uint16) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	packet.AppendChild(response)
+	return packet
+}
+
+func searchResultEntry(id int64, entry directoryEntry) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, ""))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	for name, values := range entry.attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, ""))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	response.AppendChild(attributes)
+	packet.AppendChild(response)
+	return packet
+}
+
+// unreachableURL returns the URL of a port nothing listens on.
+func unreachableURL(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return "ldap://" + addr
+}
+
+const aliceDN = "uid=alice,ou=people,dc=example,dc=com"
+
+func newTestLDAPService(t *testing.T, db *database.Database, directory *testDirectory, urls ...string) *LDAPService {
+	t.Helper()
+	cfg := config.LDAPConfig{
+		URLs:              urls,
+		StartTLS:          true,
+		BindDN:            testServiceDN,
+		BindPassword:      testServicePassword,
+		BaseDN:            "ou=people,dc=example,dc=com",
+		UserFilter:        "(|(mail={login})(uid={login}))",
+		IDAttribute:       "entryUUID",
+		EmailAttribute:    "mail",
+		UsernameAttribute: "uid",
+		GroupAttribute:    "memberOf",
+		GroupRoles:        []config.LDAPGroupRole{{Group: "cn=admins,ou=groups,dc=example,dc=com", Role: "admin"}},
+		DefaultRole:       "user",
+	}
+	var rootCAs *x509.CertPool
+	if directory != nil {
+		rootCAs = directory.rootCAs
+	}
+	log := newTestLogger()
+	return NewLDAPService(cfg, rootCAs, NewIdentityService(db, log), db, log)
+}
+
+func newAliceDirectory(t *testing.T) *testDirectory {
+	return newTestDirectory(t, directoryEntry{
+		dn:       aliceDN,
+		password: "directory-password",
+		attributes: map[string][]string{
+			"uid":       {"alice"},
+			"mail":      {"Alice@Example.com"},
+			"entryUUID": {"5f0c8a4e-0000-4000-8000-000000000001"},
+			"memberOf":  {"CN=Admins, OU=Groups,DC=example,DC=com"},
+		},
+	})
+}
+
+func TestLDAPLoginProvisionsUserWithGroupRole(t *testing.T) {
+	db := newTestDB(t)
+	directory := newAliceDirectory(t)
+	// The first server is down: logins fail over to the next one
+	svc := newTestLDAPService(t, db, directory, unreachableURL(t), directory.URL())
+
+	principal, err := svc.Authenticate(Credentials{Login: "alice", Password: "directory-password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := principal.User
+	if principal.Method != MethodLDAP || user.Email != "alice@example.com" || user.Username != "alice" || user.Role.Name != "admin" {
+		t.Fatalf("unexpected principal %+v with user %+v", principal, user)
+	}
+	if managed, err := svc.Manages(user.ID); err != nil || !managed {
+		t.Fatalf("account not linked to the directory: %v", err)
+	}
+
+	// Leaving the group demotes the account on the next login
+	directory.setAttribute(aliceDN, "memberOf")
+	principal, err = svc.Authenticate(Credentials{Login: "alice@example.com", Password: "directory-password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.User.ID != user.ID || principal.User.Role.Name != "user" {
+		t.Fatalf("got user %d with role %s, want %d with role user", principal.User.ID, principal.User.Role.Name, user.ID)
+	}
+	var stored model.User
+	if err := db.Preload("Role").First(&stored, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Role.Name != "user" {
+		t.Fatalf("stored role %s, want user", stored.Role.Name)
+	}
+}
+
+func TestLDAPLoginRejectsInvalidPassword(t *testing.T) {
+	db := newTestDB(t)
+	directory := newAliceDirectory(t)
+	svc := newTestLDAPService(t, db, directory, directory.URL())
+
+	for _, password := range []string{"wrong-password", ""} {
+		if _, err := svc.Authenticate(Credentials{Login: "alice", Password: password}); err == nil || errors.Is(err, ErrPass) {
+			t.Errorf("password %q: got %v, want a rejection", password, err)
+		}
+	}
+	var count int64
+	db.Model(&model.User{}).Count(&count)
+	if count != 0 {
+		t.Fatal("account provisioned without a successful bind")
+	}
+}
+
+func TestLDAPPassesUnknownLogin(t *testing.T) {
+	db := newTestDB(t)
+	directory := newAliceDirectory(t)
+	svc := newTestLDAPService(t, db, directory, directory.URL())
+
+	for _, login := range []string{"bob@example.com", "*)(uid=*"} {
+		if _, err := svc.Authenticate(Credentials{Login: login, Password: "directory-password"}); !errors.Is(err, ErrPass) {
+			t.Errorf("login %q: got %v, want ErrPass", login, err)
+		}
+	}
+	directory.mu.Lock()
+	defer directory.mu.Unlock()
+	if last := directory.searches[len(directory.searches)-1]; !strings.Contains(last, `\2a\29\28uid=\2a`) {
+		t.Fatalf("login not escaped in filter %s", last)
+	}
+}
+
+func TestLDAPUnavailableFallsBackToLocalPassword(t *testing.T) {
+	db := newTestDB(t)
+	directory := newAliceDirectory(t)
+	createTestUser(t, db, "jane", "jane@example.com", "local-password", "user")
+
+	// A directory whose certificate is not trusted is as unreachable as one that is down
+	untrusted := newTestLDAPService(t, db, nil, unreachableURL(t), directory.URL())
+	auth, _ := newTestAuthService(t, db, untrusted, NewPasswordAuthenticator(db, untrusted))
+
+	result, err := auth.Login("jane@example.com", "local-password", SessionInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Method != MethodPassword || result.Tokens == nil {
+		t.Fatalf("unexpected login result %+v", result)
+	}
+	if _, err := auth.Login("alice", "directory-password", SessionInfo{}); err == nil {
+		t.Fatal("directory login succeeded without a reachable directory")
+	}
+}
+
+func TestLDAPLoginRefusesExistingAccount(t *testing.T) {
+	db := newTestDB(t)
+	directory := newAliceDirectory(t)
+	admin := createTestUser(t, db, "root", "alice@example.com", "local-password", "admin")
+
+	svc := newTestLDAPService(t, db, directory, directory.URL())
+	if _, err := svc.Authenticate(Credentials{Login: "alice", Password: "directory-password"}); !errors.Is(err, ErrIdentityConflict) {
+		t.Fatalf("got %v, want ErrIdentityConflict", err)
+	}
+	if managed, _ := svc.Manages(admin.ID); managed {
+		t.Fatal("existing account linked to the directory")
+	}
+
+	svc.config.LinkExisting = true
+	principal, err := svc.Authenticate(Credentials{Login: "alice", Password: "directory-password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.User.ID != admin.ID {
+		t.Fatalf("signed in user %d, want the linked account %d", principal.User.ID, admin.ID)
+	}
+}
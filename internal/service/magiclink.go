@@ -0,0 +1,108 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/mail"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	magicLinkPurpose = "magic_link"
+	MagicLinkTTL     = 15 * time.Minute
+)
+
+type MagicLinkService struct {
+	db          *database.Database
+	tokenStore  lib.TokenStore
+	mailer      mail.Sender
+	frontendURL string
+	issuer      string
+	secret      []byte
+	log         *logrus.Logger
+}
+
+func NewMagicLinkService(db *database.Database, tokenStore lib.TokenStore, mailer mail.Sender, frontendURL, issuer string, secret []byte, log *logrus.Logger) *MagicLinkService {
+	return &MagicLinkService{db: db, tokenStore: tokenStore, mailer: mailer, frontendURL: frontendURL, issuer: issuer, secret: secret, log: log}
+}
+
+// Request emails a one-time login link bound to nonce, which the caller keeps in the requesting
+// browser. It does not report whether the account exists.
+func (s *MagicLinkService) Request(email, nonce, deviceName string) error {
+	var user model.User
+	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
+		return nil
+	}
+
+	token, err := lib.GeneratePurposeToken(magicLinkPurpose, user.ID, MagicLinkTTL, map[string]string{
+		"email":       user.Email,
+		"nonce_hash":  lib.HashToken(nonce),
+		"device_name": deviceName,
+	}, s.issuer, s.secret)
+	if err != nil {
+		return err
+	}
+
+	link := s.frontendURL + "/login/magic-link?token=" + url.QueryEscape(token)
+	go func() {
+		err := s.mailer.Send(mail.Message{
+			To:      user.Email,
+			Subject: "Your sign-in link",
+			Body: fmt.Sprintf("Hi %s,\n\nOpen the link below in the same browser you requested it from to sign in:\n\n%s\n\n"+
+				"The link expires in 15 minutes and can be used once. If you did not request it, you can ignore this email.\n",
+				user.Username, link),
+		})
+		if err != nil {
+			s.log.WithError(err).WithField("user_id", user.ID).Error("Failed to send magic link email")
+		}
+	}()
+	return nil
+}
+
+// Consume validates a magic link token against the browser nonce and burns it. Following the
+// link proves ownership of the address, so the email is marked verified.
+func (s *MagicLinkService) Consume(token, nonce string) (*model.User, string, error) {
+	claims, err := lib.ParsePurposeToken(token, magicLinkPurpose, s.issuer, s.secret)
+	if err != nil {
+		return nil, "", err
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(lib.HashToken(nonce)), []byte(claims.Data["nonce_hash"])) != 1 {
+		s.log.WithFields(logrus.Fields{
+			"event":   "magic_link_nonce_mismatch",
+			"user_id": claims.UserID,
+		}).Warn("Security event: magic link opened in a different browser than it was requested from")
+		return nil, "", errors.New("magic link was requested from a different browser")
+	}
+
+	var user model.User
+	if err := s.db.Preload("Role").Where("id = ?", claims.UserID).First(&user).Error; err != nil {
+		return nil, "", errors.New("user not found")
+	}
+	if user.Email != claims.Data["email"] {
+		return nil, "", errors.New("email has changed since the link was issued")
+	}
+
+	fresh, err := s.tokenStore.Consume(claims.ID, MagicLinkTTL)
+	if err != nil {
+		return nil, "", err
+	}
+	if !fresh {
+		return nil, "", errors.New("magic link already used")
+	}
+
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		if err := s.db.Model(&user).Update("email_verified_at", now).Error; err != nil {
+			return nil, "", err
+		}
+		user.EmailVerifiedAt = &now
+	}
+	return &user, claims.Data["device_name"], nil
+}
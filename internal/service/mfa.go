@@ -0,0 +1,182 @@
+package service
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"image/png"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	totpPeriod = 30
+	totpSkew   = 1
+)
+
+var (
+	ErrMFANotEnrolled = errors.New("mfa not enrolled")
+	ErrInvalidMFACode = errors.New("invalid mfa code")
+)
+
+// TOTPEnrollment is returned when a user starts enrolling an authenticator app
+type TOTPEnrollment struct {
+	Secret     string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	OTPAuthURL string `json:"otpauth_url" example:"otpauth://totp/Gin%20Auth:john@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Gin%20Auth"`
+	QRCode     string `json:"qr_code" example:"data:image/png;base64,iVBORw0KGgo..."`
+}
+
+type MFAService struct {
+	db     *database.Database
+	issuer string
+	log    *logrus.Logger
+}
+
+func NewMFAService(db *database.Database, issuer string, log *logrus.Logger) *MFAService {
+	return &MFAService{db: db, issuer: issuer, log: log}
+}
+
+// IsEnabled reports whether the user has a confirmed TOTP factor.
+func (s *MFAService) IsEnabled(userID uint) (bool, error) {
+	var count int64
+	if err := s.db.Model(&model.TOTPFactor{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// StartEnrollment generates a new TOTP secret for the user. Any previous unconfirmed
+// enrollment is replaced; a confirmed one must be disabled first.
+func (s *MFAService) StartEnrollment(userID uint) (*TOTPEnrollment, error) {
+	var user model.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	enabled, err := s.IsEnabled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, errors.New("mfa already enabled")
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.issuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	factor := model.TOTPFactor{UserID: user.ID}
+	if err := s.db.Where("user_id = ?", user.ID).
+		Assign(map[string]interface{}{"secret": key.Secret(), "last_used_step": 0}).
+		FirstOrCreate(&factor).Error; err != nil {
+		return nil, err
+	}
+
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret:     key.Secret(),
+		OTPAuthURL: key.URL(),
+		QRCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// ConfirmEnrollment activates a pending enrollment once the user proves possession with a valid code.
+func (s *MFAService) ConfirmEnrollment(userID uint, code string) error {
+	var factor model.TOTPFactor
+	if err := s.db.Where("user_id = ?", userID).First(&factor).Error; err != nil {
+		return ErrMFANotEnrolled
+	}
+	if factor.ConfirmedAt != nil {
+		return errors.New("mfa already enabled")
+	}
+	return s.verify(&factor, code, func(tx *gorm.DB) error {
+		return tx.Model(&factor).Update("confirmed_at", time.Now()).Error
+	})
+}
+
+// Verify checks a code against the user's confirmed factor. Each code is accepted only once.
+func (s *MFAService) Verify(userID uint, code string) error {
+	var factor model.TOTPFactor
+	if err := s.db.Where("user_id = ? AND confirmed_at IS NOT NULL", userID).First(&factor).Error; err != nil {
+		return ErrMFANotEnrolled
+	}
+	return s.verify(&factor, code, nil)
+}
+
+// Disable removes the user's factor after verifying a current code.
+func (s *MFAService) Disable(userID uint, code string) error {
+	if err := s.Verify(userID, code); err != nil {
+		return err
+	}
+	return s.db.Where("user_id = ?", userID).Delete(&model.TOTPFactor{}).Error
+}
+
+func (s *MFAService) verify(factor *model.TOTPFactor, code string, onSuccess func(tx *gorm.DB) error) error {
+	step, ok := matchTOTPStep(factor.Secret, code, time.Now())
+	if !ok || step <= factor.LastUsedStep {
+		return ErrInvalidMFACode
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// Guard against the same code being accepted twice by concurrent requests
+		result := tx.Model(&model.TOTPFactor{}).
+			Where("id = ? AND last_used_step < ?", factor.ID, step).
+			Update("last_used_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidMFACode
+		}
+		if onSuccess != nil {
+			return onSuccess(tx)
+		}
+		return nil
+	})
+}
+
+// matchTOTPStep returns the time step within the allowed skew whose code matches.
+func matchTOTPStep(secret, code string, now time.Time) (int64, bool) {
+	opts := totp.ValidateOpts{
+		Period:    totpPeriod,
+		Skew:      0,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	}
+	current := now.Unix() / totpPeriod
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		step := current + offset
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), opts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
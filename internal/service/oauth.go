@@ -0,0 +1,401 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	authorizationCodeCeremony = "authorization_code"
+	authorizationCodeTTL      = time.Minute
+)
+
+// OAuthError is a protocol error reported to clients with an RFC 6749 error code.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// AuthorizationRequest carries the parameters of an /oauth/authorize request.
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// TokenRequest carries the parameters of an /oauth/token request.
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	DeviceCode   string
+	Scope        string
+
+	SubjectToken       string
+	SubjectTokenType   string
+	Audience           string
+	RequestedTokenType string
+}
+
+// TokenResponse is the RFC 6749 token endpoint response.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+// authorizationCode is the state stored under an issued code until it is exchanged.
+type authorizationCode struct {
+	ClientID      string `json:"client_id"`
+	UserID        uint   `json:"user_id"`
+	RedirectURI   string `json:"redirect_uri"`
+	Scope         string `json:"scope"`
+	Nonce         string `json:"nonce,omitempty"`
+	CodeChallenge string `json:"code_challenge"`
+	SessionID     string `json:"sid,omitempty"` // Login session that approved the request
+}
+
+// ConsentPrompt tells the login UI what an authorization request asks for and whether the user
+// has to be asked. RedirectTo is set instead when the request must be reported back to the client.
+type ConsentPrompt struct {
+	ClientID        string   `json:"client_id,omitempty"`
+	ClientName      string   `json:"client_name,omitempty"`
+	Scopes          []string `json:"scopes,omitempty"`
+	ConsentRequired bool     `json:"consent_required"`
+	RedirectTo      string   `json:"redirect_to,omitempty"`
+}
+
+type OAuthService struct {
+	db         *database.Database
+	clients    *OAuthClientService
+	auth       *AuthService
+	devices    *DeviceService
+	grants     *GrantService
+	ceremonies lib.CeremonyStore
+	log        *logrus.Logger
+}
+
+func NewOAuthService(db *database.Database, clients *OAuthClientService, auth *AuthService, devices *DeviceService, grants *GrantService, ceremonies lib.CeremonyStore, log *logrus.Logger) *OAuthService {
+	return &OAuthService{db: db, clients: clients, auth: auth, devices: devices, grants: grants, ceremonies: ceremonies, log: log}
+}
+
+// CheckAuthorization validates an authorization request before the user is sent to log in.
+// An unknown client or unregistered redirect URI is returned as an error and must not be
+// redirected; other problems are returned as an error redirect to the client.
+func (s *OAuthService) CheckAuthorization(req AuthorizationRequest) (string, error) {
+	client, err := s.validateRedirect(req)
+	if err != nil {
+		return "", err
+	}
+	if _, oerr := s.validateAuthorization(client, req); oerr != nil {
+		return errorRedirect(req, oerr)
+	}
+	return "", nil
+}
+
+// Consent describes an authorization request to the logged-in user. Consent is not required
+// when the user already granted every requested scope to the client.
+func (s *OAuthService) Consent(userID uint, req AuthorizationRequest) (*ConsentPrompt, error) {
+	client, err := s.validateRedirect(req)
+	if err != nil {
+		return nil, err
+	}
+	scope, oerr := s.validateAuthorization(client, req)
+	if oerr != nil {
+		redirectTo, err := errorRedirect(req, oerr)
+		return &ConsentPrompt{RedirectTo: redirectTo}, err
+	}
+	covered, err := s.grants.Covers(userID, client.ClientID, scope)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsentPrompt{
+		ClientID:        client.ClientID,
+		ClientName:      client.Name,
+		Scopes:          strings.Fields(scope),
+		ConsentRequired: !covered,
+	}, nil
+}
+
+// Authorize answers an authorization request for the user logged in with sessionID and returns
+// the redirect URI to send them to. approve records the user's decision on the consent screen;
+// without one (nil) the request is only approved if a prior grant covers the requested scopes.
+// The client's session ends when sessionID does.
+func (s *OAuthService) Authorize(userID uint, sessionID string, req AuthorizationRequest, approve *bool) (string, error) {
+	client, err := s.validateRedirect(req)
+	if err != nil {
+		return "", err
+	}
+	scope, oerr := s.validateAuthorization(client, req)
+	if oerr != nil {
+		return errorRedirect(req, oerr)
+	}
+
+	switch {
+	case approve == nil:
+		covered, err := s.grants.Covers(userID, client.ClientID, scope)
+		if err != nil {
+			return "", err
+		}
+		if !covered {
+			return errorRedirect(req, oauthError("consent_required", "The user has not granted the requested scopes"))
+		}
+	case !*approve:
+		s.log.WithFields(logrus.Fields{"user_id": userID, "client_id": client.ClientID}).Info("Authorization denied by user")
+		return errorRedirect(req, oauthError("access_denied", "The user denied the request"))
+	default:
+		if err := s.grants.Record(userID, client.ClientID, scope); err != nil {
+			return "", err
+		}
+	}
+
+	code, err := lib.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.ceremonies.Save(authorizationCodeCeremony, lib.HashToken(code), authorizationCode{
+		ClientID:      client.ClientID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         scope,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		SessionID:     sessionID,
+	}, authorizationCodeTTL); err != nil {
+		return "", err
+	}
+
+	s.log.WithFields(logrus.Fields{"user_id": userID, "client_id": client.ClientID}).Info("Authorization code issued")
+	return redirectWith(req.RedirectURI, map[string]string{"code": code, "state": req.State})
+}
+
+// Token handles the token endpoint. Errors reported to the client are *OAuthError.
+func (s *OAuthService) Token(req TokenRequest, info SessionInfo) (*TokenResponse, error) {
+	client, err := s.clients.Authenticate(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, oauthError("invalid_client", "Client authentication failed")
+	}
+
+	if !client.AllowsGrant(req.GrantType) {
+		switch req.GrantType {
+		case "authorization_code", "refresh_token", "client_credentials", DeviceCodeGrantType, TokenExchangeGrantType:
+			return nil, oauthError("unauthorized_client", "Grant type not allowed for this client")
+		default:
+			return nil, oauthError("unsupported_grant_type", "Unsupported grant type")
+		}
+	}
+
+	switch req.GrantType {
+	case "authorization_code":
+		return s.exchangeCode(client, req, info)
+	case "refresh_token":
+		if req.RefreshToken == "" {
+			return nil, oauthError("invalid_request", "refresh_token is required")
+		}
+		tokens, err := s.auth.RefreshToken(req.RefreshToken, client.ClientID, info)
+		if err != nil {
+			return nil, oauthError("invalid_grant", "Invalid refresh token")
+		}
+		return tokenResponse(tokens, ""), nil
+	case "client_credentials":
+		return s.clientCredentials(client, req.Scope)
+	case DeviceCodeGrantType:
+		return s.devices.Exchange(client, req.DeviceCode, info)
+	case TokenExchangeGrantType:
+		return s.exchangeToken(client, req)
+	default:
+		return nil, oauthError("unsupported_grant_type", "Unsupported grant type")
+	}
+}
+
+func (s *OAuthService) exchangeCode(client *model.OAuthClient, req TokenRequest, info SessionInfo) (*TokenResponse, error) {
+	if req.Code == "" || req.CodeVerifier == "" {
+		return nil, oauthError("invalid_request", "code and code_verifier are required")
+	}
+
+	var code authorizationCode
+	if err := s.ceremonies.Take(authorizationCodeCeremony, lib.HashToken(req.Code), &code); err != nil {
+		if errors.Is(err, lib.ErrCeremonyNotFound) {
+			return nil, oauthError("invalid_grant", "Invalid or expired authorization code")
+		}
+		return nil, err
+	}
+	if code.ClientID != client.ClientID || code.RedirectURI != req.RedirectURI {
+		return nil, oauthError("invalid_grant", "Authorization code was not issued to this client or redirect URI")
+	}
+	if !verifyCodeChallenge(req.CodeVerifier, code.CodeChallenge) {
+		return nil, oauthError("invalid_grant", "PKCE verification failed")
+	}
+
+	var user model.User
+	if err := s.db.Preload("Role").Where("id = ?", code.UserID).First(&user).Error; err != nil {
+		return nil, oauthError("invalid_grant", "User not found")
+	}
+
+	info.ClientID = client.ClientID
+	info.Scope = code.Scope
+	info.ParentID = code.SessionID
+	if info.DeviceName == "" {
+		info.DeviceName = client.Name
+	}
+	tokens, err := s.auth.StartOAuthSession(&user, info, code.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.WithFields(logrus.Fields{"user_id": user.ID, "client_id": client.ClientID}).Info("Authorization code exchanged")
+	return tokenResponse(tokens, code.Scope), nil
+}
+
+// clientCredentials issues an access token to a confidential client acting on its own behalf.
+// No refresh token is issued; the client simply requests a new token.
+func (s *OAuthService) clientCredentials(client *model.OAuthClient, requested string) (*TokenResponse, error) {
+	if !client.IsConfidential() {
+		return nil, oauthError("unauthorized_client", "Only confidential clients may use client_credentials")
+	}
+	scope, oerr := grantedScope(client, requested)
+	if oerr != nil {
+		return nil, oerr
+	}
+
+	accessToken, err := s.auth.IssueClientToken(client.ClientID, scope)
+	if err != nil {
+		return nil, err
+	}
+	s.log.WithFields(logrus.Fields{"client_id": client.ClientID, "scope": scope}).Info("Client credentials token issued")
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(lib.AccessTokenTTL.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+func (s *OAuthService) validateRedirect(req AuthorizationRequest) (*model.OAuthClient, error) {
+	client, err := s.clients.Get(req.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if !client.HasRedirectURI(req.RedirectURI) {
+		return nil, errors.New("redirect URI is not registered for this client")
+	}
+	return client, nil
+}
+
+// validateAuthorization checks the parameters that are reported back to the client and returns
+// the granted scope. PKCE with S256 is mandatory for every client.
+func (s *OAuthService) validateAuthorization(client *model.OAuthClient, req AuthorizationRequest) (string, *OAuthError) {
+	if req.ResponseType != "code" {
+		return "", oauthError("unsupported_response_type", "Only the code response type is supported")
+	}
+	if !client.AllowsGrant("authorization_code") {
+		return "", oauthError("unauthorized_client", "The authorization code flow is not allowed for this client")
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return "", oauthError("invalid_request", "PKCE with code_challenge_method S256 is required")
+	}
+	return grantedScope(client, req.Scope)
+}
+
+// grantedScope checks the requested scopes against the client's allowed scopes. An empty
+// request is granted every allowed scope.
+func grantedScope(client *model.OAuthClient, requested string) (string, *OAuthError) {
+	scope := requested
+	if scope == "" {
+		scope = client.AllowedScopes
+	}
+	for _, s := range strings.Fields(scope) {
+		if !hasScope(client.AllowedScopes, s) {
+			return "", oauthError("invalid_scope", "Scope "+s+" is not allowed for this client")
+		}
+	}
+	return strings.Join(strings.Fields(scope), " "), nil
+}
+
+// verifyCodeChallenge checks a PKCE code_verifier against the S256 challenge (RFC 7636).
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// hasScope reports whether the space separated scope list contains scope.
+func hasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func tokenResponse(tokens *TokenPair, scope string) *TokenResponse {
+	return &TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(lib.AccessTokenTTL.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		Scope:        scope,
+	}
+}
+
+// errorRedirect reports an authorization error to the client's redirect URI (RFC 6749 4.1.2.1).
+func errorRedirect(req AuthorizationRequest, oerr *OAuthError) (string, error) {
+	return redirectWith(req.RedirectURI, map[string]string{
+		"error":             oerr.Code,
+		"error_description": oerr.Description,
+		"state":             req.State,
+	})
+}
+
+// redirectWith adds the non-empty params to the query of a registered redirect URI.
+func redirectWith(redirectURI string, params map[string]string) (string, error) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	for key, value := range params {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
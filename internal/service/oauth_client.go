@@ -0,0 +1,184 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidClient = errors.New("invalid client")
+
+// ClientRegistration describes a client to register
+type ClientRegistration struct {
+	Name             string
+	Type             string
+	RedirectURIs     []string
+	AllowedScopes    []string
+	GrantTypes       []string // Defaults to authorization_code and refresh_token
+	AllowedAudiences []string // Audiences the client may request with token exchange
+	LogoutURI        string   // Back-channel logout endpoint, optional
+}
+
+type OAuthClientService struct {
+	db                 *database.Database
+	initialAccessToken string
+	log                *logrus.Logger
+}
+
+func NewOAuthClientService(db *database.Database, initialAccessToken string, log *logrus.Logger) *OAuthClientService {
+	return &OAuthClientService{db: db, initialAccessToken: initialAccessToken, log: log}
+}
+
+// Create registers a client on behalf of an admin; it is active right away. Confidential
+// clients get a secret, which is returned only once.
+func (s *OAuthClientService) Create(reg ClientRegistration) (*model.OAuthClient, string, error) {
+	if err := validateRegistration(&reg); err != nil {
+		return nil, "", err
+	}
+	client, secret, err := newClient(reg)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.db.Create(client).Error; err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+// List returns the registered clients, optionally only those with the given status.
+func (s *OAuthClientService) List(status string) ([]model.OAuthClient, error) {
+	query := s.db.Order("created_at")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var clients []model.OAuthClient
+	if err := query.Find(&clients).Error; err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (s *OAuthClientService) Delete(id uint) error {
+	var client model.OAuthClient
+	if err := s.db.Where("id = ?", id).First(&client).Error; err != nil {
+		return errors.New("client not found")
+	}
+	return s.remove(&client)
+}
+
+// SetStatus approves, re-enables or disables a client. Disabled clients can no longer obtain
+// tokens; tokens they already hold stay valid until they expire.
+func (s *OAuthClientService) SetStatus(id uint, status string) (*model.OAuthClient, error) {
+	var client model.OAuthClient
+	if err := s.db.Where("id = ?", id).First(&client).Error; err != nil {
+		return nil, errors.New("client not found")
+	}
+	if err := s.db.Model(&client).Update("status", status).Error; err != nil {
+		return nil, err
+	}
+	client.Status = status
+	return &client, nil
+}
+
+// Get returns an active client.
+func (s *OAuthClientService) Get(clientID string) (*model.OAuthClient, error) {
+	var client model.OAuthClient
+	if err := s.db.Where("client_id = ? AND status = ?", clientID, model.OAuthClientActive).First(&client).Error; err != nil {
+		return nil, ErrInvalidClient
+	}
+	return &client, nil
+}
+
+// Authenticate identifies the client calling the token endpoint. Confidential clients must
+// present their secret; public clients are identified by client_id alone.
+func (s *OAuthClientService) Authenticate(clientID, secret string) (*model.OAuthClient, error) {
+	client, err := s.Get(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.IsConfidential() {
+		if secret == "" || subtle.ConstantTimeCompare([]byte(lib.HashToken(secret)), []byte(client.SecretHash)) != 1 {
+			return nil, ErrInvalidClient
+		}
+	}
+	return client, nil
+}
+
+// remove deletes a client together with the grants users gave it.
+func (s *OAuthClientService) remove(client *model.OAuthClient) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("client_id = ?", client.ClientID).Delete(&model.OAuthGrant{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(client).Error
+	})
+}
+
+// validateRegistration checks a registration and fills in the default grant types.
+func validateRegistration(reg *ClientRegistration) error {
+	if len(reg.GrantTypes) == 0 {
+		reg.GrantTypes = []string{"authorization_code", "refresh_token"}
+	}
+	for _, grantType := range reg.GrantTypes {
+		switch {
+		case (grantType == "client_credentials" || grantType == TokenExchangeGrantType) && reg.Type != model.OAuthClientConfidential:
+			return errors.New("only confidential clients may use the " + grantType + " grant")
+		case grantType == "authorization_code" && len(reg.RedirectURIs) == 0:
+			return errors.New("the authorization_code grant requires at least one redirect URI")
+		case grantType == TokenExchangeGrantType && len(reg.AllowedAudiences) == 0:
+			return errors.New("token exchange requires at least one allowed audience")
+		}
+	}
+	for _, uri := range reg.RedirectURIs {
+		parsed, err := url.Parse(uri)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" || strings.ContainsAny(uri, " #") {
+			return errors.New("redirect URIs must be absolute URLs without fragment")
+		}
+	}
+	if reg.LogoutURI != "" {
+		if err := validateLogoutURI(reg.LogoutURI); err != nil {
+			return err
+		}
+	}
+	for _, value := range append(append([]string{}, reg.AllowedScopes...), reg.AllowedAudiences...) {
+		if value == "" || strings.ContainsAny(value, " \t\n") {
+			return errors.New("scopes and audiences must not be empty or contain spaces")
+		}
+	}
+	return nil
+}
+
+// newClient builds an active client with a fresh client ID and, for confidential clients, a secret.
+func newClient(reg ClientRegistration) (*model.OAuthClient, string, error) {
+	clientID, err := lib.NewTokenID()
+	if err != nil {
+		return nil, "", err
+	}
+	client := &model.OAuthClient{
+		ClientID:         clientID,
+		Name:             reg.Name,
+		Type:             reg.Type,
+		RedirectURIs:     strings.Join(reg.RedirectURIs, " "),
+		AllowedScopes:    strings.Join(reg.AllowedScopes, " "),
+		GrantTypes:       strings.Join(reg.GrantTypes, " "),
+		AllowedAudiences: strings.Join(reg.AllowedAudiences, " "),
+		LogoutURI:        reg.LogoutURI,
+		Status:           model.OAuthClientActive,
+	}
+
+	var secret string
+	if client.IsConfidential() {
+		if secret, err = lib.NewOpaqueToken(); err != nil {
+			return nil, "", err
+		}
+		client.SecretHash = lib.HashToken(secret)
+	}
+	return client, secret, nil
+}
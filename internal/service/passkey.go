@@ -0,0 +1,272 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	passkeyRegistrationCeremony = "passkey_registration"
+	passkeyLoginCeremony        = "passkey_login"
+	passkeyCeremonyTTL          = 5 * time.Minute
+)
+
+var ErrPasskeyNotFound = errors.New("passkey not found")
+
+// passkeyCeremony is the server-side state kept between the begin and finish steps
+type passkeyCeremony struct {
+	UserID  uint                 `json:"user_id,omitempty"`
+	Session webauthn.SessionData `json:"session"`
+}
+
+// webAuthnUser adapts a model.User and its passkeys to the webauthn.User interface.
+type webAuthnUser struct {
+	user        *model.User
+	credentials []model.PasskeyCredential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return userHandle(u.user.ID)
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, c := range u.credentials {
+		var transports []protocol.AuthenticatorTransport
+		for _, t := range strings.Split(c.Transports, ",") {
+			if t != "" {
+				transports = append(transports, protocol.AuthenticatorTransport(t))
+			}
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		})
+	}
+	return credentials
+}
+
+// userHandle is the opaque WebAuthn user handle stored on the authenticator for a user.
+func userHandle(userID uint) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+type PasskeyService struct {
+	db         *database.Database
+	webauthn   *webauthn.WebAuthn
+	ceremonies lib.CeremonyStore
+	log        *logrus.Logger
+}
+
+func NewPasskeyService(db *database.Database, wa *webauthn.WebAuthn, ceremonies lib.CeremonyStore, log *logrus.Logger) *PasskeyService {
+	return &PasskeyService{db: db, webauthn: wa, ceremonies: ceremonies, log: log}
+}
+
+// BeginRegistration starts a registration ceremony for the user and returns the options for
+// navigator.credentials.create() along with the ceremony ID to send back on completion.
+func (s *PasskeyService) BeginRegistration(userID uint) (*protocol.CredentialCreation, string, error) {
+	user, err := s.loadUser(userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	creation, session, err := s.webauthn.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(user.WebAuthnCredentials()).CredentialDescriptors()),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ceremonyID, err := s.saveCeremony(passkeyRegistrationCeremony, passkeyCeremony{UserID: userID, Session: *session})
+	if err != nil {
+		return nil, "", err
+	}
+	return creation, ceremonyID, nil
+}
+
+// FinishRegistration verifies the authenticator's attestation response and stores the new credential.
+func (s *PasskeyService) FinishRegistration(userID uint, ceremonyID, name string, response []byte) (*model.PasskeyCredential, error) {
+	var ceremony passkeyCeremony
+	if err := s.ceremonies.Take(passkeyRegistrationCeremony, ceremonyID, &ceremony); err != nil {
+		return nil, err
+	}
+	if ceremony.UserID != userID {
+		return nil, errors.New("ceremony does not belong to user")
+	}
+
+	user, err := s.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := s.webauthn.CreateCredential(user, ceremony.Session, parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+	if name == "" {
+		name = "Passkey"
+	}
+	passkey := model.PasskeyCredential{
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		Transports:      strings.Join(transports, ","),
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+	if err := s.db.Create(&passkey).Error; err != nil {
+		return nil, err
+	}
+	return &passkey, nil
+}
+
+func (s *PasskeyService) List(userID uint) ([]model.PasskeyCredential, error) {
+	var passkeys []model.PasskeyCredential
+	if err := s.db.Where("user_id = ?", userID).Order("created_at").Find(&passkeys).Error; err != nil {
+		return nil, err
+	}
+	return passkeys, nil
+}
+
+// Delete removes a passkey unless it is the user's last login method.
+func (s *PasskeyService) Delete(userID, id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var passkey model.PasskeyCredential
+		if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&passkey).Error; err != nil {
+			return ErrPasskeyNotFound
+		}
+		if err := ensureOtherLoginMethod(tx, userID); err != nil {
+			return err
+		}
+		return tx.Delete(&passkey).Error
+	})
+}
+
+// BeginLogin starts a discoverable (usernameless) login ceremony.
+func (s *PasskeyService) BeginLogin() (*protocol.CredentialAssertion, string, error) {
+	assertion, session, err := s.webauthn.BeginDiscoverableLogin()
+	if err != nil {
+		return nil, "", err
+	}
+
+	ceremonyID, err := s.saveCeremony(passkeyLoginCeremony, passkeyCeremony{Session: *session})
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, ceremonyID, nil
+}
+
+// FinishLogin verifies an assertion and returns the user owning the credential.
+func (s *PasskeyService) FinishLogin(ceremonyID string, response []byte) (*model.User, error) {
+	var ceremony passkeyCeremony
+	if err := s.ceremonies.Take(passkeyLoginCeremony, ceremonyID, &ceremony); err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, credential, err := s.webauthn.ValidatePasskeyLogin(func(rawID, handle []byte) (webauthn.User, error) {
+		var passkey model.PasskeyCredential
+		if err := s.db.Where("credential_id = ?", rawID).First(&passkey).Error; err != nil {
+			return nil, errors.New("unknown credential")
+		}
+		if !bytes.Equal(handle, userHandle(passkey.UserID)) {
+			return nil, errors.New("user handle mismatch")
+		}
+		return s.loadUser(passkey.UserID)
+	}, ceremony.Session, parsed)
+	if err != nil {
+		return nil, err
+	}
+	user := owner.(*webAuthnUser).user
+
+	if credential.Authenticator.CloneWarning {
+		s.log.WithFields(logrus.Fields{
+			"event":   "passkey_clone_warning",
+			"user_id": user.ID,
+		}).Warn("Security event: passkey signature counter did not increase, possible cloned authenticator")
+		return nil, errors.New("passkey sign count check failed")
+	}
+
+	if err := s.db.Model(&model.PasskeyCredential{}).
+		Where("credential_id = ?", credential.ID).
+		Updates(map[string]interface{}{
+			"sign_count":   credential.Authenticator.SignCount,
+			"backup_state": credential.Flags.BackupState,
+			"last_used_at": time.Now(),
+		}).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *PasskeyService) loadUser(userID uint) (*webAuthnUser, error) {
+	var user model.User
+	if err := s.db.Preload("Role").Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	var credentials []model.PasskeyCredential
+	if err := s.db.Where("user_id = ?", userID).Find(&credentials).Error; err != nil {
+		return nil, err
+	}
+	return &webAuthnUser{user: &user, credentials: credentials}, nil
+}
+
+func (s *PasskeyService) saveCeremony(kind string, ceremony passkeyCeremony) (string, error) {
+	ceremonyID, err := lib.NewTokenID()
+	if err != nil {
+		return "", err
+	}
+	if err := s.ceremonies.Save(kind, ceremonyID, ceremony, passkeyCeremonyTTL); err != nil {
+		return "", err
+	}
+	return ceremonyID, nil
+}
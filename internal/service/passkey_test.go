@@ -0,0 +1,258 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "https://localhost"
+)
+
+// softwareAuthenticator is a minimal platform authenticator holding a single ES256 passkey.
+type softwareAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+}
+
+func newSoftwareAuthenticator(t *testing.T) *softwareAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+	return &softwareAuthenticator{t: t, key: key, credentialID: credentialID}
+}
+
+func (a *softwareAuthenticator) authenticatorData(flags byte, signCount uint32, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, signCount)
+	return append(data, attested...)
+}
+
+func (a *softwareAuthenticator) clientData(ceremony string, challenge protocol.URLEncodedBase64) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+// create answers navigator.credentials.create() with a "none" attestation.
+func (a *softwareAuthenticator) create(creation *protocol.CredentialCreation) []byte {
+	a.userHandle = creation.Response.User.ID.(protocol.URLEncodedBase64)
+	publicKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(append(attested, a.credentialID...), publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(0x45, 0, attested), // UP, UV, AT
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return a.response(map[string]string{
+		"clientDataJSON":    encode(a.clientData("webauthn.create", creation.Response.Challenge)),
+		"attestationObject": encode(attestation),
+	})
+}
+
+// get answers navigator.credentials.get() with an assertion carrying signCount.
+func (a *softwareAuthenticator) get(assertion *protocol.CredentialAssertion, signCount uint32) []byte {
+	clientData := a.clientData("webauthn.get", assertion.Response.Challenge)
+	authData := a.authenticatorData(0x05, signCount, nil) // UP, UV
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return a.response(map[string]string{
+		"clientDataJSON":    encode(clientData),
+		"authenticatorData": encode(authData),
+		"signature":         encode(signature),
+		"userHandle":        encode(a.userHandle),
+	})
+}
+
+func (a *softwareAuthenticator) response(fields map[string]string) []byte {
+	data, err := json.Marshal(map[string]interface{}{
+		"id":       encode(a.credentialID),
+		"rawId":    encode(a.credentialID),
+		"type":     "public-key",
+		"response": fields,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func newTestPasskeyService(t *testing.T) (*PasskeyService, *model.User) {
+	t.Helper()
+	db := newTestDB(t)
+	wa, err := webauthn.New(&webauthn.Config{RPID: testRPID, RPDisplayName: "Test", RPOrigins: []string{testOrigin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := createTestUser(t, db, "jane", "jane@example.com", "password123", "user")
+	return NewPasskeyService(db, wa, newTestCeremonyStore(t), newTestLogger()), user
+}
+
+// registerPasskey runs a full registration ceremony for the user with the authenticator.
+func registerPasskey(t *testing.T, svc *PasskeyService, userID uint, authenticator *softwareAuthenticator) *model.PasskeyCredential {
+	t.Helper()
+	creation, ceremonyID, err := svc.BeginRegistration(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passkey, err := svc.FinishRegistration(userID, ceremonyID, "Laptop", authenticator.create(creation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return passkey
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	svc, user := newTestPasskeyService(t)
+	authenticator := newSoftwareAuthenticator(t)
+
+	passkey := registerPasskey(t, svc, user.ID, authenticator)
+	if passkey.Name != "Laptop" || string(passkey.CredentialID) != string(authenticator.credentialID) {
+		t.Fatalf("unexpected passkey %+v", passkey)
+	}
+
+	assertion, ceremonyID, err := svc.BeginLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loggedIn, err := svc.FinishLogin(ceremonyID, authenticator.get(assertion, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loggedIn.ID != user.ID || loggedIn.Role.Name != "user" {
+		t.Fatalf("logged in as %+v", loggedIn)
+	}
+
+	passkeys, err := svc.List(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passkeys) != 1 || passkeys[0].SignCount != 1 || passkeys[0].LastUsedAt == nil {
+		t.Fatalf("passkey use not recorded: %+v", passkeys)
+	}
+}
+
+func TestPasskeyRegistrationRejectsWrongChallenge(t *testing.T) {
+	svc, user := newTestPasskeyService(t)
+	authenticator := newSoftwareAuthenticator(t)
+
+	creation, _, err := svc.BeginRegistration(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherCeremonyID, err := svc.BeginRegistration(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FinishRegistration(user.ID, otherCeremonyID, "", authenticator.create(creation)); err == nil {
+		t.Fatal("registration accepted a response to another ceremony's challenge")
+	}
+}
+
+func TestPasskeyLoginRejectsWrongChallenge(t *testing.T) {
+	svc, user := newTestPasskeyService(t)
+	authenticator := newSoftwareAuthenticator(t)
+	registerPasskey(t, svc, user.ID, authenticator)
+
+	assertion, _, err := svc.BeginLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherCeremonyID, err := svc.BeginLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FinishLogin(otherCeremonyID, authenticator.get(assertion, 1)); err == nil {
+		t.Fatal("login accepted an assertion for another ceremony's challenge")
+	}
+}
+
+func TestPasskeyLoginRejectsSignCountRegression(t *testing.T) {
+	svc, user := newTestPasskeyService(t)
+	authenticator := newSoftwareAuthenticator(t)
+	registerPasskey(t, svc, user.ID, authenticator)
+
+	login := func(signCount uint32) error {
+		assertion, ceremonyID, err := svc.BeginLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = svc.FinishLogin(ceremonyID, authenticator.get(assertion, signCount))
+		return err
+	}
+	if err := login(5); err != nil {
+		t.Fatal(err)
+	}
+	if err := login(5); err == nil {
+		t.Fatal("login accepted a sign count that did not increase")
+	}
+	if err := login(3); err == nil {
+		t.Fatal("login accepted a sign count that went backwards")
+	}
+	passkeys, _ := svc.List(user.ID)
+	if passkeys[0].SignCount != 5 {
+		t.Fatalf("sign count %d stored after rejected logins, want 5", passkeys[0].SignCount)
+	}
+}
+
+func TestPasskeyLoginRejectsUnknownCredential(t *testing.T) {
+	svc, user := newTestPasskeyService(t)
+	registerPasskey(t, svc, user.ID, newSoftwareAuthenticator(t))
+
+	stranger := newSoftwareAuthenticator(t)
+	stranger.userHandle = userHandle(user.ID)
+	assertion, ceremonyID, err := svc.BeginLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.FinishLogin(ceremonyID, stranger.get(assertion, 1)); err == nil {
+		t.Fatal("login accepted a credential that was never registered")
+	}
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/mail"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const passwordResetTTL = 30 * time.Minute
+
+var ErrInvalidCurrentPassword = errors.New("current password is incorrect")
+
+type PasswordService struct {
+	db          *database.Database
+	sessions    *SessionService
+	mailer      mail.Sender
+	frontendURL string
+	log         *logrus.Logger
+}
+
+func NewPasswordService(db *database.Database, sessions *SessionService, mailer mail.Sender, frontendURL string, log *logrus.Logger) *PasswordService {
+	return &PasswordService{db: db, sessions: sessions, mailer: mailer, frontendURL: frontendURL, log: log}
+}
+
+// RequestReset emails a reset link if the address belongs to an account. It does not report
+// whether the account exists; the email is sent in the background so timing does not either.
+func (s *PasswordService) RequestReset(email string) error {
+	var user model.User
+	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
+		return nil
+	}
+
+	token, err := lib.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	reset := model.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: lib.HashToken(token),
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	}
+	if err := s.db.Create(&reset).Error; err != nil {
+		return err
+	}
+
+	link := s.frontendURL + "/reset-password?token=" + url.QueryEscape(token)
+	go func() {
+		err := s.mailer.Send(mail.Message{
+			To:      user.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Hi %s,\n\nA password reset was requested for your account. Open the link below to choose a new password:\n\n%s\n\n"+
+				"The link expires in 30 minutes and can be used once. If you did not request this, you can ignore this email.\n",
+				user.Username, link),
+		})
+		if err != nil {
+			s.log.WithError(err).WithField("user_id", user.ID).Error("Failed to send password reset email")
+		}
+	}()
+	return nil
+}
+
+// ResetPassword consumes a reset token, sets the new password and revokes every session and
+// personal access token of the user.
+func (s *PasswordService) ResetPassword(token, password string) (*model.User, error) {
+	var reset model.PasswordResetToken
+	if err := s.db.Where("token_hash = ?", lib.HashToken(token)).First(&reset).Error; err != nil {
+		return nil, errors.New("invalid reset token")
+	}
+	if reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		return nil, errors.New("reset token expired or already used")
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	var user model.User
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&model.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", reset.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("reset token expired or already used")
+		}
+		// Any other pending links for this user are void once the password changed
+		if err := tx.Model(&model.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", reset.UserID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		// A reset recovers the account, so tokens an attacker may have created must not survive it
+		if err := revokePersonalAccessTokens(tx, reset.UserID); err != nil {
+			return err
+		}
+
+		if err := tx.Where("id = ?", reset.UserID).First(&user).Error; err != nil {
+			return errors.New("user not found")
+		}
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"password":   string(hashed),
+			"updated_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.sessions.RevokeAll(user.ID); err != nil {
+		return nil, err
+	}
+
+	s.notifyPasswordChanged(&user)
+	return &user, nil
+}
+
+// ChangePassword replaces the password of an authenticated user after checking the current one.
+// Every other session is revoked; the session identified by keepFamilyID stays signed in.
+func (s *PasswordService) ChangePassword(userID uint, keepFamilyID, currentPassword, newPassword string) error {
+	var user model.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return errors.New("user not found")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)); err != nil {
+		return ErrInvalidCurrentPassword
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(newPassword)) == nil {
+		return errors.New("new password must differ from the current password")
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	// The password only changes together with the revocation, so that a failed request can be retried
+	var revocation *sessionRevocation
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"password":   string(hashed),
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		// A token without a session (empty keepFamilyID) cannot be kept apart, so every session is revoked
+		_, revocation, err = s.sessions.revokeOthers(tx, user.ID, keepFamilyID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.sessions.finish(revocation); err != nil {
+		return err
+	}
+
+	s.notifyPasswordChanged(&user)
+	return nil
+}
+
+func (s *PasswordService) notifyPasswordChanged(user *model.User) {
+	err := s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Your password was changed",
+		Body: fmt.Sprintf("Hi %s,\n\nThe password of your account was just changed and your other devices were signed out.\n"+
+			"If this was not you, reset your password immediately and contact support.\n", user.Username),
+	})
+	if err != nil {
+		s.log.WithError(err).WithField("user_id", user.ID).Error("Failed to send password change notification")
+	}
+}
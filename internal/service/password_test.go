@@ -0,0 +1,64 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	db := newTestDB(t)
+	log := newTestLogger()
+	tokenStore := newTestTokenStore(t)
+	sessions := NewSessionService(db, tokenStore, NewBackchannelLogoutService(db, nil, testIssuer, log), log)
+	passwords := NewPasswordService(db, sessions, &testMailer{}, "https://app.example.com", log)
+	user := createTestUser(t, db, "jane", "jane@example.com", "password123", "user")
+	for _, family := range []string{"current", "other"} {
+		expires := time.Now().Add(time.Hour)
+		if err := db.Create(&model.Session{UserID: user.ID, FamilyID: family, ExpiresAt: expires}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(&model.RefreshToken{TokenID: family + "-token", FamilyID: family, UserID: user.ID, ExpiresAt: expires}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A failed revocation leaves the password unchanged, so the request can be retried
+	if err := db.Migrator().RenameTable(&model.RefreshToken{}, "refresh_tokens_unavailable"); err != nil {
+		t.Fatal(err)
+	}
+	if err := passwords.ChangePassword(user.ID, "current", "password123", "new-password-123"); err == nil {
+		t.Fatal("password changed although the sessions could not be revoked")
+	}
+	var stored model.User
+	db.First(&stored, user.ID)
+	if bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("password123")) != nil {
+		t.Fatal("password changed by the failed request")
+	}
+	if err := db.Migrator().RenameTable("refresh_tokens_unavailable", &model.RefreshToken{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := passwords.ChangePassword(user.ID, "current", "password123", "new-password-123"); err != nil {
+		t.Fatal(err)
+	}
+	db.First(&stored, user.ID)
+	if bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("new-password-123")) != nil {
+		t.Fatal("password not changed")
+	}
+	for family, wantRevoked := range map[string]bool{"current": false, "other": true} {
+		var session model.Session
+		db.Where("family_id = ?", family).First(&session)
+		var token model.RefreshToken
+		db.Where("family_id = ?", family).First(&token)
+		revoked, err := tokenStore.IsSessionRevoked(family)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (session.RevokedAt != nil) != wantRevoked || (token.RevokedAt != nil) != wantRevoked || revoked != wantRevoked {
+			t.Errorf("session %s: revoked %v, want %v", family, session.RevokedAt != nil, wantRevoked)
+		}
+	}
+}
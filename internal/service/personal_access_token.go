@@ -0,0 +1,122 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPersonalAccessTokenTTL = 30 * 24 * time.Hour
+	maxPersonalAccessTokens       = 50
+	personalAccessTokenTouchEvery = time.Minute // Last use is recorded at most this often
+)
+
+var ErrPersonalAccessTokenNotFound = errors.New("personal access token not found")
+
+// PersonalAccessTokenService manages the long-lived tokens users create to call the API from
+// scripts. A token acts as its user, optionally restricted to a subset of the scopes read
+// (safe methods), write (all methods) and admin (admin routes, for admins).
+type PersonalAccessTokenService struct {
+	db  *database.Database
+	log *logrus.Logger
+}
+
+func NewPersonalAccessTokenService(db *database.Database, log *logrus.Logger) *PersonalAccessTokenService {
+	return &PersonalAccessTokenService{db: db, log: log}
+}
+
+// Create issues a token for the user and returns it with its record. The token itself is only
+// available here; a zero ttl uses the default of 30 days.
+func (s *PersonalAccessTokenService) Create(userID uint, role, name string, scopes []string, ttl time.Duration) (*model.PersonalAccessToken, string, error) {
+	scope := strings.Join(scopes, " ")
+	if hasScope(scope, "admin") && role != "admin" {
+		return nil, "", errors.New("only admins can create tokens with the admin scope")
+	}
+	if ttl == 0 {
+		ttl = defaultPersonalAccessTokenTTL
+	}
+	var count int64
+	if err := s.db.Model(&model.PersonalAccessToken{}).Where("user_id = ? AND expires_at > ?", userID, time.Now()).Count(&count).Error; err != nil {
+		return nil, "", err
+	}
+	if count >= maxPersonalAccessTokens {
+		return nil, "", errors.New("too many personal access tokens; revoke unused ones first")
+	}
+
+	secret, err := lib.NewOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+	token := lib.PersonalAccessTokenPrefix + secret
+	record := model.PersonalAccessToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: lib.HashToken(token),
+		Prefix:    token[:len(lib.PersonalAccessTokenPrefix)+8],
+		Scope:     scope,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		return nil, "", err
+	}
+	s.log.WithFields(logrus.Fields{"user_id": userID, "token_id": record.ID}).Info("Personal access token created")
+	return &record, token, nil
+}
+
+// List returns the user's tokens, newest first, including expired ones.
+func (s *PersonalAccessTokenService) List(userID uint) ([]model.PersonalAccessToken, error) {
+	var tokens []model.PersonalAccessToken
+	err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// Revoke deletes one of the user's tokens; it stops working on the next request.
+func (s *PersonalAccessTokenService) Revoke(userID, id uint) error {
+	result := s.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.PersonalAccessToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPersonalAccessTokenNotFound
+	}
+	s.log.WithFields(logrus.Fields{"user_id": userID, "token_id": id}).Info("Personal access token revoked")
+	return nil
+}
+
+// revokePersonalAccessTokens deletes all of a user's tokens, when the account is recovered or
+// deleted.
+func revokePersonalAccessTokens(tx *gorm.DB, userID uint) error {
+	return tx.Where("user_id = ?", userID).Delete(&model.PersonalAccessToken{}).Error
+}
+
+// Verify returns the unexpired token and its user (with role) for a presented token, and
+// records its use from ipAddress.
+func (s *PersonalAccessTokenService) Verify(token, ipAddress string) (*model.PersonalAccessToken, *model.User, error) {
+	var record model.PersonalAccessToken
+	if err := s.db.Where("token_hash = ?", lib.HashToken(token)).First(&record).Error; err != nil {
+		return nil, nil, ErrPersonalAccessTokenNotFound
+	}
+	now := time.Now()
+	if now.After(record.ExpiresAt) {
+		return nil, nil, errors.New("personal access token expired")
+	}
+	var user model.User
+	if err := s.db.Preload("Role").Where("id = ?", record.UserID).First(&user).Error; err != nil {
+		return nil, nil, errors.New("user not found")
+	}
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= personalAccessTokenTouchEvery || record.LastUsedIP != ipAddress {
+		err := s.db.Model(&record).Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": truncate(ipAddress, 45)}).Error
+		if err != nil {
+			s.log.WithError(err).WithField("token_id", record.ID).Warn("Failed to record personal access token use")
+		}
+	}
+	return &record, &user, nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+)
+
+func TestPersonalAccessTokenLifecycle(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewPersonalAccessTokenService(db, newTestLogger())
+	user := createTestUser(t, db, "jane", "jane@example.com", "password123", "user")
+
+	if _, _, err := svc.Create(user.ID, "user", "ci", []string{"admin"}, 0); err == nil {
+		t.Fatal("non-admin created a token with the admin scope")
+	}
+	record, token, err := svc.Create(user.ID, "user", "ci", []string{"read"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored model.PersonalAccessToken
+	if err := db.First(&stored, record.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.TokenHash != lib.HashToken(token) || stored.TokenHash == token {
+		t.Fatal("token is not stored as its hash")
+	}
+
+	verified, owner, err := svc.Verify(token, "203.0.113.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner.ID != user.ID || verified.Scope != "read" {
+		t.Fatalf("verified %+v for user %d", verified, owner.ID)
+	}
+	if err := db.First(&stored, record.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.LastUsedAt == nil || stored.LastUsedIP != "203.0.113.10" {
+		t.Fatal("last use not recorded")
+	}
+
+	if err := svc.Revoke(user.ID+1, record.ID); err != ErrPersonalAccessTokenNotFound {
+		t.Fatalf("revoking another user's token: %v", err)
+	}
+	if err := svc.Revoke(user.ID, record.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.Verify(token, ""); err == nil {
+		t.Fatal("revoked token still verifies")
+	}
+
+	_, expired, err := svc.Create(user.ID, "user", "old", nil, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, _, err := svc.Verify(expired, ""); err == nil {
+		t.Fatal("expired token still verifies")
+	}
+}
+
+func TestPasswordResetRevokesPersonalAccessTokens(t *testing.T) {
+	db := newTestDB(t)
+	log := newTestLogger()
+	tokens := NewPersonalAccessTokenService(db, log)
+	sessions := NewSessionService(db, newTestTokenStore(t), NewBackchannelLogoutService(db, nil, testIssuer, log), log)
+	passwords := NewPasswordService(db, sessions, &testMailer{}, "https://app.example.com", log)
+	user := createTestUser(t, db, "jane", "jane@example.com", "password123", "user")
+
+	_, token, err := tokens.Create(user.ID, "user", "attacker", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reset := model.PasswordResetToken{UserID: user.ID, TokenHash: lib.HashToken("reset-token"), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := db.Create(&reset).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := passwords.ResetPassword("reset-token", "new-password-123"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tokens.Verify(token, ""); err == nil {
+		t.Fatal("personal access token survived the password reset")
+	}
+}
+
+func TestDeleteUserRevokesPersonalAccessTokens(t *testing.T) {
+	db := newTestDB(t)
+	log := newTestLogger()
+	tokens := NewPersonalAccessTokenService(db, log)
+	sessions := NewSessionService(db, newTestTokenStore(t), NewBackchannelLogoutService(db, nil, testIssuer, log), log)
+	users := NewUserService(db, nil, sessions, log)
+	user := createTestUser(t, db, "jane", "jane@example.com", "password123", "user")
+
+	_, token, err := tokens.Create(user.ID, "user", "script", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.DeleteUserByID(user.ID); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&model.PersonalAccessToken{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 0 {
+		t.Fatalf("%d tokens left after deleting the user", count)
+	}
+	if _, _, err := tokens.Verify(token, ""); err == nil {
+		t.Fatal("token of a deleted user still verifies")
+	}
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+)
+
+// ClientMetadata is the client metadata of the dynamic registration endpoints (RFC 7591).
+type ClientMetadata struct {
+	ClientName              string   `json:"client_name" example:"Billing dashboard"`
+	RedirectURIs            []string `json:"redirect_uris,omitempty" example:"https://billing.example.com/callback"`
+	GrantTypes              []string `json:"grant_types,omitempty" example:"authorization_code,refresh_token"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty" example:"client_secret_basic"`
+	Scope                   string   `json:"scope" example:"openid email profile"`
+	BackchannelLogoutURI    string   `json:"backchannel_logout_uri,omitempty" example:"https://billing.example.com/backchannel-logout"`
+}
+
+// ClientInformation is the response of the dynamic registration endpoints. The client secret
+// and registration access token are only returned when the client is registered.
+type ClientInformation struct {
+	ClientID                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   int64  `json:"client_secret_expires_at"` // 0: never expires
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri"`
+	Status                  string `json:"status"`
+	ClientMetadata
+}
+
+// selfRegistrableGrants are the grant types clients may request for themselves. Token exchange
+// is left to admins since its audiences are a policy decision.
+const selfRegistrableGrants = "authorization_code refresh_token client_credentials " + DeviceCodeGrantType
+
+// Register creates a client from metadata presented with the initial access token. The client
+// stays pending until an admin approves it. Returns the client secret (confidential clients)
+// and the registration access token used to manage the registration afterwards.
+func (s *OAuthClientService) Register(initialAccessToken string, metadata ClientMetadata) (*model.OAuthClient, string, string, error) {
+	if s.initialAccessToken == "" || subtle.ConstantTimeCompare([]byte(initialAccessToken), []byte(s.initialAccessToken)) != 1 {
+		return nil, "", "", oauthError("invalid_token", "Invalid initial access token")
+	}
+
+	reg, oerr := metadataRegistration(metadata)
+	if oerr != nil {
+		return nil, "", "", oerr
+	}
+	client, secret, err := newClient(reg)
+	if err != nil {
+		return nil, "", "", err
+	}
+	registrationToken, err := lib.NewOpaqueToken()
+	if err != nil {
+		return nil, "", "", err
+	}
+	client.Status = model.OAuthClientPending
+	client.SelfRegistered = true
+	client.RegistrationHash = lib.HashToken(registrationToken)
+
+	if err := s.db.Create(client).Error; err != nil {
+		return nil, "", "", err
+	}
+	s.log.WithFields(logrus.Fields{"client_id": client.ClientID, "name": client.Name}).Info("OAuth client self-registered, pending approval")
+	return client, secret, registrationToken, nil
+}
+
+// Registration returns a self-registered client identified by its registration access token (RFC 7592).
+func (s *OAuthClientService) Registration(clientID, registrationToken string) (*model.OAuthClient, error) {
+	var client model.OAuthClient
+	if err := s.db.Where("client_id = ? AND self_registered = ?", clientID, true).First(&client).Error; err != nil {
+		return nil, oauthError("invalid_token", "Invalid registration access token")
+	}
+	if registrationToken == "" || subtle.ConstantTimeCompare([]byte(lib.HashToken(registrationToken)), []byte(client.RegistrationHash)) != 1 {
+		return nil, oauthError("invalid_token", "Invalid registration access token")
+	}
+	return &client, nil
+}
+
+// UpdateRegistration replaces the metadata of a self-registered client. An approved client that
+// asks for new redirect URIs, scopes, grant types or logout URI goes back to pending for another review.
+func (s *OAuthClientService) UpdateRegistration(clientID, registrationToken string, metadata ClientMetadata) (*model.OAuthClient, error) {
+	client, err := s.Registration(clientID, registrationToken)
+	if err != nil {
+		return nil, err
+	}
+	reg, oerr := metadataRegistration(metadata)
+	if oerr != nil {
+		return nil, oerr
+	}
+	if reg.Type != client.Type {
+		return nil, oauthError("invalid_client_metadata", "token_endpoint_auth_method cannot be changed")
+	}
+
+	redirectURIs := strings.Join(reg.RedirectURIs, " ")
+	scopes := strings.Join(reg.AllowedScopes, " ")
+	grantTypes := strings.Join(reg.GrantTypes, " ")
+	if client.IsActive() && (widens(client.RedirectURIs, redirectURIs) || widens(client.AllowedScopes, scopes) ||
+		widens(client.GrantTypes, grantTypes) || (reg.LogoutURI != "" && reg.LogoutURI != client.LogoutURI)) {
+		client.Status = model.OAuthClientPending
+	}
+	client.Name = reg.Name
+	client.RedirectURIs = redirectURIs
+	client.AllowedScopes = scopes
+	client.GrantTypes = grantTypes
+	client.LogoutURI = reg.LogoutURI
+
+	if err := s.db.Save(client).Error; err != nil {
+		return nil, err
+	}
+	s.log.WithFields(logrus.Fields{"client_id": client.ClientID, "status": client.Status}).Info("OAuth client registration updated")
+	return client, nil
+}
+
+// DeleteRegistration removes a self-registered client.
+func (s *OAuthClientService) DeleteRegistration(clientID, registrationToken string) error {
+	client, err := s.Registration(clientID, registrationToken)
+	if err != nil {
+		return err
+	}
+	if err := s.remove(client); err != nil {
+		return err
+	}
+	s.log.WithField("client_id", client.ClientID).Info("OAuth client registration deleted")
+	return nil
+}
+
+// NewClientInformation describes a registered client in the RFC 7591 response format.
+func NewClientInformation(client *model.OAuthClient, registrationClientURI string) *ClientInformation {
+	authMethod := "client_secret_basic"
+	if !client.IsConfidential() {
+		authMethod = "none"
+	}
+	return &ClientInformation{
+		ClientID:              client.ClientID,
+		ClientIDIssuedAt:      client.CreatedAt.Unix(),
+		RegistrationClientURI: registrationClientURI,
+		Status:                client.Status,
+		ClientMetadata: ClientMetadata{
+			ClientName:              client.Name,
+			RedirectURIs:            strings.Fields(client.RedirectURIs),
+			GrantTypes:              strings.Fields(client.GrantTypes),
+			TokenEndpointAuthMethod: authMethod,
+			Scope:                   client.AllowedScopes,
+			BackchannelLogoutURI:    client.LogoutURI,
+		},
+	}
+}
+
+// metadataRegistration maps RFC 7591 metadata onto a client registration and validates it.
+func metadataRegistration(metadata ClientMetadata) (ClientRegistration, *OAuthError) {
+	reg := ClientRegistration{
+		Name:          strings.TrimSpace(metadata.ClientName),
+		RedirectURIs:  metadata.RedirectURIs,
+		AllowedScopes: strings.Fields(metadata.Scope),
+		GrantTypes:    metadata.GrantTypes,
+		LogoutURI:     metadata.BackchannelLogoutURI,
+	}
+	switch metadata.TokenEndpointAuthMethod {
+	case "none":
+		reg.Type = model.OAuthClientPublic
+	case "", "client_secret_basic", "client_secret_post":
+		reg.Type = model.OAuthClientConfidential
+	default:
+		return reg, oauthError("invalid_client_metadata", "Unsupported token_endpoint_auth_method")
+	}
+	if reg.Name == "" || len(reg.Name) > 100 {
+		return reg, oauthError("invalid_client_metadata", "client_name is required and at most 100 characters")
+	}
+	if len(reg.AllowedScopes) == 0 {
+		return reg, oauthError("invalid_client_metadata", "scope is required")
+	}
+	for _, grantType := range reg.GrantTypes {
+		if !hasScope(selfRegistrableGrants, grantType) {
+			return reg, oauthError("invalid_client_metadata", "Grant type "+grantType+" cannot be self-registered")
+		}
+	}
+	if err := validateRegistration(&reg); err != nil {
+		return reg, oauthError("invalid_client_metadata", err.Error())
+	}
+	return reg, nil
+}
+
+// widens reports whether the space separated list next contains a value missing from current.
+func widens(current, next string) bool {
+	for _, value := range strings.Fields(next) {
+		if !hasScope(current, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/shahariaz/gin-auth-service/internal/config"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	samlLoginCeremony  = "saml_login"
+	samlMetadataLimit  = 1 << 20
+	samlEmailAttribute = "urn:oid:0.9.2342.19200300.100.1.3"
+	samlUIDAttribute   = "urn:oid:0.9.2342.19200300.100.1.1"
+)
+
+// samlLogin is the state kept between the AuthnRequest and the IdP's response, keyed by RelayState.
+type samlLogin struct {
+	Provider    string `json:"provider"`
+	RequestID   string `json:"request_id"`   // Expected InResponseTo of the assertion
+	BindingHash string `json:"binding_hash"` // Ties the response to the browser that started the login
+	DeviceName  string `json:"device_name,omitempty"`
+	LinkUserID  uint   `json:"link_user_id,omitempty"`
+}
+
+// samlProvider is a configured IdP with the service provider we act as towards it. The IdP
+// metadata is loaded on first use, so that an unreachable IdP does not prevent the service
+// from starting.
+type samlProvider struct {
+	config config.SAMLProvider
+	mu     sync.Mutex
+	sp     *saml.ServiceProvider
+}
+
+// SAMLService signs users in with external SAML 2.0 identity providers (service provider).
+// Only SP-initiated logins are accepted: the request goes out with the HTTP-Redirect binding
+// and the signed response comes back with the HTTP-POST binding.
+type SAMLService struct {
+	identities *IdentityService
+	providers  map[string]*samlProvider
+	order      []string
+	ceremonies lib.CeremonyStore
+	httpClient *http.Client
+	log        *logrus.Logger
+}
+
+// NewSAMLService configures one service provider per IdP, with entity ID
+// <issuer>/login/saml/<name>/metadata and ACS <issuer>/login/saml/<name>/acs. key and cert are
+// optional: with them AuthnRequests are signed and encrypted assertions can be read.
+func NewSAMLService(providers []config.SAMLProvider, key *rsa.PrivateKey, cert *x509.Certificate, identities *IdentityService, ceremonies lib.CeremonyStore, issuer string, log *logrus.Logger) *SAMLService {
+	s := &SAMLService{
+		identities: identities,
+		providers:  make(map[string]*samlProvider, len(providers)),
+		ceremonies: ceremonies,
+		httpClient: &http.Client{Timeout: federationTimeout},
+		log:        log,
+	}
+	base, err := url.Parse(issuer)
+	if err != nil {
+		log.WithError(err).Error("Invalid issuer URL, SAML login is disabled")
+		return s
+	}
+	for _, provider := range providers {
+		if provider.DisplayName == "" {
+			provider.DisplayName = provider.Name
+		}
+		if provider.DefaultRole == "" {
+			provider.DefaultRole = defaultFederatedRole
+		}
+		sp := &saml.ServiceProvider{
+			EntityID:          base.JoinPath("login", "saml", provider.Name, "metadata").String(),
+			Key:               key,
+			Certificate:       cert,
+			HTTPClient:        s.httpClient,
+			MetadataURL:       *base.JoinPath("login", "saml", provider.Name, "metadata"),
+			AcsURL:            *base.JoinPath("login", "saml", provider.Name, "acs"),
+			AuthnNameIDFormat: saml.PersistentNameIDFormat,
+		}
+		if key != nil {
+			sp.SignatureMethod = dsig.RSASHA256SignatureMethod
+		}
+		s.providers[provider.Name] = &samlProvider{config: provider, sp: sp}
+		s.order = append(s.order, provider.Name)
+	}
+	return s
+}
+
+// Providers lists the configured providers in configuration order.
+func (s *SAMLService) Providers() []ProviderInfo {
+	providers := make([]ProviderInfo, 0, len(s.order))
+	for _, name := range s.order {
+		providers = append(providers, ProviderInfo{Name: name, DisplayName: s.providers[name].config.DisplayName})
+	}
+	return providers
+}
+
+// Metadata returns the SP metadata to register at the provider.
+func (s *SAMLService) Metadata(providerName string) ([]byte, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	metadata, err := xml.MarshalIndent(provider.sp.Metadata(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), metadata...), nil
+}
+
+// Begin starts a login with the provider and returns the URL carrying the AuthnRequest to
+// redirect the browser to. binding is a secret kept by the browser (cookie) and checked on the
+// response.
+func (s *SAMLService) Begin(providerName, binding, deviceName string) (string, error) {
+	return s.begin(providerName, binding, samlLogin{DeviceName: deviceName})
+}
+
+// BeginLink starts linking an account at the provider to the signed-in user's account.
+func (s *SAMLService) BeginLink(userID uint, providerName, binding string) (string, error) {
+	return s.begin(providerName, binding, samlLogin{LinkUserID: userID})
+}
+
+func (s *SAMLService) begin(providerName, binding string, login samlLogin) (string, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return "", err
+	}
+	location := provider.sp.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+	if location == "" {
+		return "", errors.New("identity provider does not support the HTTP-Redirect binding")
+	}
+	request, err := provider.sp.MakeAuthenticationRequest(location, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", err
+	}
+
+	relayState, err := lib.NewTokenID()
+	if err != nil {
+		return "", err
+	}
+	login.Provider = providerName
+	login.RequestID = request.ID
+	login.BindingHash = lib.HashToken(binding)
+	if err := s.ceremonies.Save(samlLoginCeremony, relayState, login, FederatedLoginTTL); err != nil {
+		return "", err
+	}
+	redirect, err := request.Redirect(relayState, provider.sp)
+	if err != nil {
+		return "", err
+	}
+	return redirect.String(), nil
+}
+
+// Complete handles a response posted to the ACS. The response must be signed by the provider
+// and answer the request of the same login. Like FederationService.Complete, it then signs the
+// user in, provisioning an account with the provider's default role on first use, or links the
+// identity.
+func (s *SAMLService) Complete(providerName, relayState, samlResponse, binding string) (*FederationResult, error) {
+	var login samlLogin
+	if err := s.ceremonies.Take(samlLoginCeremony, relayState, &login); err != nil {
+		return nil, errors.New("unknown or expired login state")
+	}
+	if login.Provider != providerName || lib.HashToken(binding) != login.BindingHash {
+		return nil, errors.New("login was started from another browser")
+	}
+
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	response, err := base64.StdEncoding.DecodeString(samlResponse)
+	if err != nil {
+		return nil, errors.New("SAMLResponse is not base64 encoded")
+	}
+	assertion, err := provider.sp.ParseXMLResponse(response, []string{login.RequestID})
+	if err != nil {
+		// The error message is deliberately generic; the reason is kept for the logs
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) && invalid.PrivateErr != nil {
+			return nil, fmt.Errorf("invalid SAML response: %w", invalid.PrivateErr)
+		}
+		return nil, err
+	}
+	identity, err := provider.identity(assertion)
+	if err != nil {
+		return nil, err
+	}
+
+	if login.LinkUserID != 0 {
+		linked, err := s.identities.Link(login.LinkUserID, identity)
+		if err != nil {
+			return nil, err
+		}
+		return &FederationResult{Linked: linked}, nil
+	}
+	user, err := s.identities.Resolve(identity, provider.config.DefaultRole)
+	if err != nil {
+		return nil, err
+	}
+	s.log.WithFields(logrus.Fields{"user_id": user.ID, "provider": identity.Provider}).Info("SAML login")
+	return &FederationResult{Principal: &Principal{User: user, Method: MethodSAML}, DeviceName: login.DeviceName}, nil
+}
+
+// provider returns the provider with its IdP metadata loaded.
+func (s *SAMLService) provider(name string) (*samlProvider, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	if provider.sp.IDPMetadata == nil {
+		metadata, err := s.loadMetadata(provider.config)
+		if err != nil {
+			return nil, err
+		}
+		provider.sp.IDPMetadata = metadata
+	}
+	return provider, nil
+}
+
+// loadMetadata reads the IdP metadata from its file or URL. Aggregates (EntitiesDescriptor)
+// are accepted; the first IdP in them is used.
+func (s *SAMLService) loadMetadata(provider config.SAMLProvider) (*saml.EntityDescriptor, error) {
+	var data []byte
+	if provider.MetadataFile != "" {
+		var err error
+		if data, err = os.ReadFile(provider.MetadataFile); err != nil {
+			return nil, err
+		}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), federationTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.MetadataURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching metadata: %s", resp.Status)
+		}
+		if data, err = io.ReadAll(io.LimitReader(resp.Body, samlMetadataLimit)); err != nil {
+			return nil, err
+		}
+	}
+
+	var entity saml.EntityDescriptor
+	if err := xml.Unmarshal(data, &entity); err == nil && len(entity.IDPSSODescriptors) > 0 {
+		return &entity, nil
+	}
+	var entities saml.EntitiesDescriptor
+	if err := xml.Unmarshal(data, &entities); err == nil {
+		for i := range entities.EntityDescriptors {
+			if len(entities.EntityDescriptors[i].IDPSSODescriptors) > 0 {
+				return &entities.EntityDescriptors[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("metadata of %s does not describe an identity provider", provider.Name)
+}
+
+// identity maps the assertion with the provider's attribute mapping. Attributes are matched by
+// Name or FriendlyName. The subject is the NameID unless a subject attribute is mapped, and
+// must be stable: a transient NameID would create a new identity on every login.
+func (p *samlProvider) identity(assertion *saml.Assertion) (*FederatedIdentity, error) {
+	values := map[string]string{}
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			if len(attribute.Values) == 0 {
+				continue
+			}
+			values[attribute.Name] = attribute.Values[0].Value
+			if attribute.FriendlyName != "" {
+				values[attribute.FriendlyName] = attribute.Values[0].Value
+			}
+		}
+	}
+	attribute := func(name string, fallbacks ...string) string {
+		if mapped, ok := p.config.Attributes[name]; ok {
+			return values[mapped]
+		}
+		for _, fallback := range fallbacks {
+			if value := values[fallback]; value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+
+	var nameID *saml.NameID
+	if assertion.Subject != nil {
+		nameID = assertion.Subject.NameID
+	}
+	subject := attribute("subject")
+	if _, mapped := p.config.Attributes["subject"]; !mapped && nameID != nil {
+		if nameID.Format == string(saml.TransientNameIDFormat) {
+			return nil, errors.New("provider sent a transient NameID; map a stable subject attribute")
+		}
+		subject = nameID.Value
+	}
+	if subject == "" {
+		return nil, errors.New("assertion has no subject")
+	}
+
+	email := attribute("email", "email", "mail", samlEmailAttribute,
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress")
+	if email == "" && nameID != nil && nameID.Format == string(saml.EmailAddressNameIDFormat) {
+		email = nameID.Value
+	}
+	return &FederatedIdentity{
+		Provider:      p.config.Name,
+		Subject:       subject,
+		Email:         strings.ToLower(strings.TrimSpace(email)),
+		EmailVerified: p.config.TrustEmail,
+		Username:      attribute("username", "username", "uid", samlUIDAttribute),
+	}, nil
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/crewjam/saml"
+	"github.com/shahariaz/gin-auth-service/internal/config"
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+)
+
+// testIdentityProvider issues signed SAML responses with a locally generated key pair.
+type testIdentityProvider struct {
+	t   *testing.T
+	idp *saml.IdentityProvider
+}
+
+type staticServiceProvider struct {
+	metadata *saml.EntityDescriptor
+}
+
+func (p staticServiceProvider) GetServiceProvider(*http.Request, string) (*saml.EntityDescriptor, error) {
+	return p.metadata, nil
+}
+
+func newTestKeyPair(t *testing.T, name string) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+// newTestSAMLService configures a provider "corp" whose IdP metadata is written to a file, and
+// registers the service provider's metadata at the IdP. Unless encrypt is set, the IdP is not
+// given the encryption key, so that assertions can be inspected and altered in transit.
+func newTestSAMLService(t *testing.T, encrypt bool) (*SAMLService, *testIdentityProvider, *database.Database) {
+	t.Helper()
+	db := newTestDB(t)
+	log := newTestLogger()
+
+	idpKey, idpCert := newTestKeyPair(t, "idp")
+	metadataURL, _ := url.Parse("https://idp.example.com/metadata")
+	ssoURL, _ := url.Parse("https://idp.example.com/sso")
+	idp := &saml.IdentityProvider{Key: idpKey, Certificate: idpCert, MetadataURL: *metadataURL, SSOURL: *ssoURL}
+	metadata, err := xml.Marshal(idp.Metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadataFile := filepath.Join(t.TempDir(), "idp.xml")
+	if err := os.WriteFile(metadataFile, metadata, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	spKey, spCert := newTestKeyPair(t, "sp")
+	provider := config.SAMLProvider{
+		Name:         "corp",
+		MetadataFile: metadataFile,
+		Attributes:   map[string]string{"email": "eduPersonPrincipalName"},
+		TrustEmail:   true,
+	}
+	svc := NewSAMLService([]config.SAMLProvider{provider}, spKey, spCert, NewIdentityService(db, log), newTestCeremonyStore(t), testIssuer, log)
+
+	spMetadata, err := svc.Metadata("corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spEntity saml.EntityDescriptor
+	if err := xml.Unmarshal(spMetadata, &spEntity); err != nil {
+		t.Fatal(err)
+	}
+	if !encrypt {
+		for i := range spEntity.SPSSODescriptors {
+			var keys []saml.KeyDescriptor
+			for _, key := range spEntity.SPSSODescriptors[i].KeyDescriptors {
+				if key.Use != "encryption" {
+					keys = append(keys, key)
+				}
+			}
+			spEntity.SPSSODescriptors[i].KeyDescriptors = keys
+		}
+	}
+	idp.ServiceProviderProvider = staticServiceProvider{&spEntity}
+	return svc, &testIdentityProvider{t: t, idp: idp}, db
+}
+
+// respond plays the user signing in at the IdP: it answers the AuthnRequest carried by the
+// redirect URL and returns the base64 encoded response to post to the ACS.
+func (p *testIdentityProvider) respond(redirect, nameID string, mutate func(*etree.Element)) string {
+	httpReq, err := http.NewRequest(http.MethodGet, redirect, nil)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	req, err := saml.NewIdpAuthnRequest(p.idp, httpReq)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if err := req.Validate(); err != nil {
+		p.t.Fatal(err)
+	}
+	err = saml.DefaultAssertionMaker{}.MakeAssertion(req, &saml.Session{
+		ID:           "idp-session",
+		NameID:       nameID,
+		NameIDFormat: string(saml.PersistentNameIDFormat),
+		UserEmail:    "Alice@Corp.example",
+		UserName:     "alice",
+		CreateTime:   time.Now(),
+		ExpireTime:   time.Now().Add(time.Hour),
+		Index:        "1",
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if err := req.MakeResponse(); err != nil {
+		p.t.Fatal(err)
+	}
+	if mutate != nil {
+		mutate(req.ResponseEl)
+	}
+	doc := etree.NewDocument()
+	doc.SetRoot(req.ResponseEl)
+	response, err := doc.WriteToBytes()
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(response)
+}
+
+// beginSAMLLogin starts a login and returns the redirect URL with its RelayState.
+func beginSAMLLogin(t *testing.T, svc *SAMLService) (string, string) {
+	t.Helper()
+	redirect, err := svc.Begin("corp", "browser-binding", "Laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Query().Get("Signature") == "" {
+		t.Fatal("AuthnRequest is not signed")
+	}
+	return redirect, parsed.Query().Get("RelayState")
+}
+
+func TestSAMLLoginProvisionsUser(t *testing.T) {
+	svc, idp, db := newTestSAMLService(t, true)
+
+	redirect, relayState := beginSAMLLogin(t, svc)
+	result, err := svc.Complete("corp", relayState, idp.respond(redirect, "alice-123", nil), "browser-binding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := result.Principal.User
+	if result.Principal.Method != MethodSAML || result.DeviceName != "Laptop" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if user.Email != "alice@corp.example" || user.Username != "alice" || user.Role.Name != "user" || user.EmailVerifiedAt == nil {
+		t.Fatalf("unexpected provisioned user %+v", user)
+	}
+	var identity model.Identity
+	if err := db.Where("provider = ? AND subject = ?", "corp", "alice-123").First(&identity).Error; err != nil {
+		t.Fatal(err)
+	}
+	if identity.UserID != user.ID {
+		t.Fatalf("identity linked to user %d, want %d", identity.UserID, user.ID)
+	}
+}
+
+func TestSAMLLoginRejectsTamperedAssertion(t *testing.T) {
+	svc, idp, _ := newTestSAMLService(t, false)
+
+	redirect, relayState := beginSAMLLogin(t, svc)
+	raw, err := base64.StdEncoding.DecodeString(idp.respond(redirect, "alice-123", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(raw), "alice-123", "mallory", 1)
+	if tampered == string(raw) {
+		t.Fatal("NameID not found in the response")
+	}
+	if _, err := svc.Complete("corp", relayState, base64.StdEncoding.EncodeToString([]byte(tampered)), "browser-binding"); err == nil {
+		t.Fatal("tampered assertion accepted")
+	}
+}
+
+func TestSAMLLoginRejectsUnsignedResponse(t *testing.T) {
+	svc, idp, _ := newTestSAMLService(t, false)
+
+	redirect, relayState := beginSAMLLogin(t, svc)
+	unsigned := idp.respond(redirect, "alice-123", func(response *etree.Element) {
+		for _, signature := range response.FindElements("//Signature") {
+			signature.Parent().RemoveChild(signature)
+		}
+	})
+	raw, _ := base64.StdEncoding.DecodeString(unsigned)
+	if strings.Contains(string(raw), "SignatureValue") {
+		t.Fatal("signatures not removed")
+	}
+	if _, err := svc.Complete("corp", relayState, unsigned, "browser-binding"); err == nil {
+		t.Fatal("unsigned response accepted")
+	}
+}
+
+func TestSAMLLoginRejectsResponseToAnotherRequest(t *testing.T) {
+	svc, idp, _ := newTestSAMLService(t, false)
+
+	firstRedirect, _ := beginSAMLLogin(t, svc)
+	_, secondRelayState := beginSAMLLogin(t, svc)
+	response := idp.respond(firstRedirect, "alice-123", nil)
+	if _, err := svc.Complete("corp", secondRelayState, response, "browser-binding"); err == nil {
+		t.Fatal("response with another InResponseTo accepted")
+	}
+}
+
+func TestSAMLLoginRejectsReplayedRelayState(t *testing.T) {
+	svc, idp, _ := newTestSAMLService(t, false)
+
+	redirect, relayState := beginSAMLLogin(t, svc)
+	response := idp.respond(redirect, "alice-123", nil)
+	if _, err := svc.Complete("corp", relayState, response, "browser-binding"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Complete("corp", relayState, response, "browser-binding"); err == nil {
+		t.Fatal("replayed RelayState accepted")
+	}
+}
+
+func TestSAMLLoginRejectsAnotherBrowser(t *testing.T) {
+	svc, idp, _ := newTestSAMLService(t, false)
+
+	redirect, relayState := beginSAMLLogin(t, svc)
+	if _, err := svc.Complete("corp", relayState, idp.respond(redirect, "alice-123", nil), "other-browser"); err == nil {
+		t.Fatal("response posted from another browser accepted")
+	}
+}
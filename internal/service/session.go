@@ -0,0 +1,227 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// SessionInfo describes the device a session is created or refreshed from and, for sessions
+// granted to an OAuth client, the client, its scopes and the login session that approved it
+type SessionInfo struct {
+	DeviceName string
+	IPAddress  string
+	UserAgent  string
+	ClientID   string
+	Scope      string
+	ParentID   string
+}
+
+type SessionService struct {
+	db         *database.Database
+	tokenStore lib.TokenStore
+	logouts    *BackchannelLogoutService
+	log        *logrus.Logger
+}
+
+func NewSessionService(db *database.Database, tokenStore lib.TokenStore, logouts *BackchannelLogoutService, log *logrus.Logger) *SessionService {
+	return &SessionService{db: db, tokenStore: tokenStore, logouts: logouts, log: log}
+}
+
+// Create persists a new session for the given refresh token family.
+func (s *SessionService) Create(tx *gorm.DB, userID uint, familyID string, info SessionInfo) error {
+	now := time.Now()
+	deviceName := info.DeviceName
+	if deviceName == "" {
+		deviceName = "Unknown device"
+	}
+	session := model.Session{
+		UserID:     userID,
+		FamilyID:   familyID,
+		DeviceName: deviceName,
+		IPAddress:  info.IPAddress,
+		UserAgent:  truncate(info.UserAgent, 512),
+		ClientID:   info.ClientID,
+		Scope:      info.Scope,
+		ParentID:   info.ParentID,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(lib.RefreshTokenTTL),
+	}
+	return tx.Create(&session).Error
+}
+
+// Touch records a refresh of the session from the given device.
+func (s *SessionService) Touch(tx *gorm.DB, familyID string, info SessionInfo) error {
+	now := time.Now()
+	return tx.Model(&model.Session{}).Where("family_id = ?", familyID).Updates(map[string]interface{}{
+		"last_used_at": now,
+		"expires_at":   now.Add(lib.RefreshTokenTTL),
+		"ip_address":   info.IPAddress,
+		"user_agent":   truncate(info.UserAgent, 512),
+	}).Error
+}
+
+// Get returns the session of a token family.
+func (s *SessionService) Get(familyID string) (*model.Session, error) {
+	var session model.Session
+	if err := s.db.Where("family_id = ?", familyID).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ListForUser returns the user's active sessions, flagging the one matching currentFamilyID.
+func (s *SessionService) ListForUser(userID uint, currentFamilyID string) ([]model.Session, error) {
+	var sessions []model.Session
+	if err := s.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = currentFamilyID != "" && sessions[i].FamilyID == currentFamilyID
+	}
+	return sessions, nil
+}
+
+// Revoke ends a single session owned by the user.
+func (s *SessionService) Revoke(userID, sessionID uint) error {
+	var session model.Session
+	if err := s.db.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).First(&session).Error; err != nil {
+		return errors.New("session not found")
+	}
+	return s.RevokeFamily(session.FamilyID)
+}
+
+// RevokeOthers ends every session of the user except the one identified by keepFamilyID.
+func (s *SessionService) RevokeOthers(userID uint, keepFamilyID string) (int, error) {
+	var count int
+	var revocation *sessionRevocation
+	err := s.db.Transaction(func(tx *gorm.DB) (err error) {
+		count, revocation, err = s.revokeOthers(tx, userID, keepFamilyID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, s.finish(revocation)
+}
+
+// revokeOthers is RevokeOthers within tx, for callers that have to revoke the sessions together
+// with another change. Once tx has committed, the caller passes the result to finish.
+func (s *SessionService) revokeOthers(tx *gorm.DB, userID uint, keepFamilyID string) (int, *sessionRevocation, error) {
+	var families []string
+	if err := tx.Model(&model.Session{}).
+		Where("user_id = ? AND family_id <> ? AND revoked_at IS NULL", userID, keepFamilyID).
+		Pluck("family_id", &families).Error; err != nil {
+		return 0, nil, err
+	}
+	revocation, err := revokeFamilies(tx, families)
+	if err != nil {
+		return 0, nil, err
+	}
+	return len(families), revocation, nil
+}
+
+// RevokeClient ends every session the OAuth client holds for the user.
+func (s *SessionService) RevokeClient(userID uint, clientID string) (int, error) {
+	var sessions []model.Session
+	if err := s.db.Where("user_id = ? AND client_id = ? AND revoked_at IS NULL", userID, clientID).
+		Find(&sessions).Error; err != nil {
+		return 0, err
+	}
+	for _, session := range sessions {
+		if err := s.RevokeFamily(session.FamilyID); err != nil {
+			return 0, err
+		}
+	}
+	return len(sessions), nil
+}
+
+// RevokeAll ends every session of the user.
+func (s *SessionService) RevokeAll(userID uint) (int, error) {
+	return s.RevokeOthers(userID, "")
+}
+
+// RevokeFamily revokes the session and every refresh token of a token family, and makes
+// access tokens issued for it unusable. OAuth sessions approved from this session end with it,
+// and clients holding an ended session are notified over the back channel.
+func (s *SessionService) RevokeFamily(familyID string) error {
+	var revocation *sessionRevocation
+	err := s.db.Transaction(func(tx *gorm.DB) (err error) {
+		revocation, err = revokeFamilies(tx, []string{familyID})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return s.finish(revocation)
+}
+
+// sessionRevocation holds the token families revoked in the database and the sessions that
+// ended with them, until finish makes the revocation known outside the database.
+type sessionRevocation struct {
+	families []string
+	sessions []model.Session
+}
+
+// revokeFamilies revokes the sessions and refresh tokens of the token families, and of the
+// OAuth sessions approved from them, in tx.
+func revokeFamilies(tx *gorm.DB, familyIDs []string) (*sessionRevocation, error) {
+	revocation := &sessionRevocation{families: familyIDs}
+	if len(familyIDs) == 0 {
+		return revocation, nil
+	}
+	if err := tx.Where("(family_id IN ? OR parent_id IN ?) AND revoked_at IS NULL", familyIDs, familyIDs).
+		Find(&revocation.sessions).Error; err != nil {
+		return nil, err
+	}
+	for _, session := range revocation.sessions {
+		if !slices.Contains(revocation.families, session.FamilyID) {
+			revocation.families = append(revocation.families, session.FamilyID)
+		}
+	}
+
+	now := time.Now()
+	if err := tx.Model(&model.RefreshToken{}).
+		Where("family_id IN ? AND revoked_at IS NULL", revocation.families).
+		Update("revoked_at", now).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&model.Session{}).
+		Where("family_id IN ? AND revoked_at IS NULL", revocation.families).
+		Update("revoked_at", now).Error; err != nil {
+		return nil, err
+	}
+	return revocation, nil
+}
+
+// finish makes access tokens of the revoked families unusable and notifies the clients that
+// held an ended session. It runs once the revocation has been committed.
+func (s *SessionService) finish(revocation *sessionRevocation) error {
+	for _, family := range revocation.families {
+		if err := s.tokenStore.RevokeSession(family, lib.AccessTokenTTL); err != nil {
+			return err
+		}
+	}
+	s.logouts.Notify(revocation.sessions)
+	return nil
+}
+
+// truncate cuts value to at most max bytes without splitting a multi-byte character.
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	for max > 0 && !utf8.RuneStart(value[max]) {
+		max--
+	}
+	return value[:max]
+}
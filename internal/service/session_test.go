@@ -0,0 +1,32 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateKeepsCharactersWhole(t *testing.T) {
+	tests := []struct {
+		value string
+		max   int
+		want  string
+	}{
+		{"Mozilla/5.0", 512, "Mozilla/5.0"},
+		{"Mozilla/5.0", 7, "Mozilla"},
+		{"naïve", 3, "na"},  // ï is 2 bytes and would be split at 3
+		{"naïve", 4, "naï"}, // Fits exactly
+		{"日本語", 5, "日"},     // 3 byte characters
+		{"日本語", 2, ""},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.value, tt.max); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.value, tt.max, got, tt.want)
+		}
+	}
+
+	long := strings.Repeat("€", 200) // 600 bytes
+	if got := truncate(long, 512); !utf8.ValidString(got) || len(got) != 510 {
+		t.Errorf("truncated user agent is %d bytes (valid UTF-8: %v), want 510", len(got), utf8.ValidString(got))
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/shahariaz/gin-auth-service/internal/model"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	TokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	AccessTokenType        = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// exchangeToken swaps a user's access token for a down-scoped token addressed to another
+// audience (RFC 8693). The calling client is recorded as actor; which audiences it may request
+// is controlled by its registration.
+func (s *OAuthService) exchangeToken(client *model.OAuthClient, req TokenRequest) (*TokenResponse, error) {
+	if !client.IsConfidential() {
+		return nil, oauthError("unauthorized_client", "Only confidential clients may exchange tokens")
+	}
+	if req.SubjectToken == "" || req.SubjectTokenType == "" || req.Audience == "" {
+		return nil, oauthError("invalid_request", "subject_token, subject_token_type and audience are required")
+	}
+	if req.SubjectTokenType != AccessTokenType {
+		return nil, oauthError("invalid_request", "Unsupported subject_token_type")
+	}
+	if req.RequestedTokenType != "" && req.RequestedTokenType != AccessTokenType {
+		return nil, oauthError("invalid_request", "Unsupported requested_token_type")
+	}
+	if strings.Contains(req.Audience, " ") || !client.AllowsAudience(req.Audience) {
+		return nil, oauthError("invalid_target", "Audience is not allowed for this client")
+	}
+
+	subject, err := s.auth.ActiveAccessToken(req.SubjectToken)
+	if err != nil || subject.IsClientToken() {
+		return nil, oauthError("invalid_grant", "Invalid subject token")
+	}
+
+	scope, oerr := exchangedScope(client, subject.Scope, req.Scope)
+	if oerr != nil {
+		return nil, oerr
+	}
+
+	accessToken, expiresAt, err := s.auth.IssueDelegatedToken(subject, client.ClientID, scope, req.Audience)
+	if err != nil {
+		return nil, err
+	}
+	s.log.WithFields(logrus.Fields{
+		"user_id":   subject.UserID,
+		"client_id": client.ClientID,
+		"audience":  req.Audience,
+		"scope":     scope,
+	}).Info("Token exchanged")
+	return &TokenResponse{
+		AccessToken:     accessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       int(time.Until(expiresAt).Seconds()),
+		Scope:           scope,
+		IssuedTokenType: AccessTokenType,
+	}, nil
+}
+
+// exchangedScope checks the requested scopes against the client's allowed scopes and, when the
+// subject token is itself scoped, against the subject's scopes so that an exchange can only
+// narrow what the user granted. An empty request gets every scope allowed by both.
+func exchangedScope(client *model.OAuthClient, subjectScope, requested string) (string, *OAuthError) {
+	if requested == "" && subjectScope != "" {
+		var common []string
+		for _, s := range strings.Fields(subjectScope) {
+			if hasScope(client.AllowedScopes, s) {
+				common = append(common, s)
+			}
+		}
+		return strings.Join(common, " "), nil
+	}
+
+	scope, oerr := grantedScope(client, requested)
+	if oerr != nil {
+		return "", oerr
+	}
+	if subjectScope != "" {
+		for _, s := range strings.Fields(scope) {
+			if !hasScope(subjectScope, s) {
+				return "", oauthError("invalid_scope", "Scope "+s+" was not granted to the subject token")
+			}
+		}
+	}
+	return scope, nil
+}
@@ -6,18 +6,21 @@ import (
 
 	"github.com/go-playground/validator/v10"
 	"github.com/shahariaz/gin-auth-service/internal/database"
+	"github.com/shahariaz/gin-auth-service/internal/lib"
 	"github.com/shahariaz/gin-auth-service/internal/model"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type UserService struct {
 	db        *database.Database
 	validator *validator.Validate
+	sessions  *SessionService
 	log       *logrus.Logger
 }
 
-func NewUserService(db *database.Database, validator *validator.Validate, log *logrus.Logger) *UserService {
-	return &UserService{db: db, validator: validator, log: log}
+func NewUserService(db *database.Database, validator *validator.Validate, sessions *SessionService, log *logrus.Logger) *UserService {
+	return &UserService{db: db, validator: validator, sessions: sessions, log: log}
 }
 
 func (s *UserService) GetUserByUsername(username string) (*model.User, error) {
@@ -28,11 +31,32 @@ func (s *UserService) GetUserByUsername(username string) (*model.User, error) {
 	return &user, nil
 }
 
+// UserInfo returns the OpenID Connect claims of a user for the /userinfo endpoint.
+func (s *UserService) UserInfo(userID uint) (*lib.UserInfo, error) {
+	var user model.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &lib.UserInfo{Subject: lib.Subject(user.ID), ProfileClaims: profileClaims(&user)}, nil
+}
+
+// profileClaims derives the standard OIDC profile claims from a user.
+func profileClaims(user *model.User) lib.ProfileClaims {
+	return lib.ProfileClaims{
+		Email:             user.Email,
+		EmailVerified:     user.EmailVerifiedAt != nil,
+		PreferredUsername: user.Username,
+	}
+}
+
 func (s *UserService) UpdateUserProfile(username, email string) (*model.User, error) {
 	var user model.User
 	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
 		return nil, err
 	}
+	if user.Email != email {
+		user.EmailVerifiedAt = nil // The new address has to be verified again
+	}
 	user.Email = email
 	user.UpdatedAt = time.Now()
 	if err := s.validator.Struct(user); err != nil {
@@ -45,7 +69,11 @@ func (s *UserService) UpdateUserProfile(username, email string) (*model.User, er
 }
 
 func (s *UserService) DeleteUser(username string) error {
-	return s.db.Where("username = ?", username).Delete(&model.User{}).Error
+	var user model.User
+	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
+		return err
+	}
+	return s.DeleteUserByID(user.ID)
 }
 
 func (s *UserService) ListUsers() ([]model.User, error) {
@@ -87,6 +115,19 @@ func (s *UserService) UpdateUser(id uint, username, email string, roleID uint) (
 	return &user, nil
 }
 
+// DeleteUserByID deletes the user along with their personal access tokens, and ends their
+// sessions so that clients holding one are notified.
 func (s *UserService) DeleteUserByID(id uint) error {
-	return s.db.Where("id = ?", id).Delete(&model.User{}).Error
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := revokePersonalAccessTokens(tx, id); err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&model.User{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.sessions.RevokeAll(id)
+	return err
 }